@@ -0,0 +1,446 @@
+package badger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+var (
+	BackupSinceKey   = attribute.Key("db.badger.backup.since")
+	BackupVersionKey = attribute.Key("db.badger.backup.version")
+	BackupBytesKey   = attribute.Key("db.badger.backup.bytes")
+)
+
+var ErrBackupChecksum = errors.New("backup checksum mismatch")
+
+const (
+	backupFlagCompressed byte = 1 << iota
+	backupFlagChecksum
+)
+
+const (
+	backupChunkSize        = 1 << 20
+	restoreMaxPendingWrite = 256
+)
+
+var (
+	backupMagic = []byte("XBBACKUP")
+	crcTable    = crc32.MakeTable(crc32.Castagnoli)
+)
+
+type backupOption struct {
+	compress bool
+	checksum bool
+	progress func(bytes int64)
+}
+
+type BackupOption = func(opt *backupOption)
+
+// WithBackupCompression gzips the backup stream.
+func WithBackupCompression(enabled bool) BackupOption {
+	return func(opt *backupOption) {
+		opt.compress = enabled
+	}
+}
+
+// WithBackupChecksum frames the backup in chunks carrying a CRC32C, checked by Restore.
+func WithBackupChecksum(enabled bool) BackupOption {
+	return func(opt *backupOption) {
+		opt.checksum = enabled
+	}
+}
+
+// WithBackupProgress calls fn with the number of bytes written or read so far.
+func WithBackupProgress(fn func(bytes int64)) BackupOption {
+	return func(opt *backupOption) {
+		opt.progress = fn
+	}
+}
+
+// Backup writes the versions at or above since to w using badger's Stream backup and
+// returns the version of the last entry written, 0 when there was none. The next
+// incremental backup starts at this version + 1. Without compression and checksum the
+// output is the plain badger backup format.
+func (t *DB) Backup(ctx context.Context, w io.Writer, since uint64, options ...BackupOption) (version uint64, err error) {
+	opt := newBackupOption(options)
+	err = t.withSpan(ctx, "db.backup", "backup", []byte{},
+		func(ctx context.Context) error {
+			counter := &countingWriter{w: w, progress: opt.progress}
+			out, closeOut, err := opt.wrapWriter(counter)
+			if err != nil {
+				return err
+			}
+			stream := t.db.NewStream()
+			stream.LogPrefix = "DB.Backup"
+			// the iterator skips the versions up to SinceTs included
+			if since > 0 {
+				stream.SinceTs = since - 1
+			}
+			version, err = stream.Backup(out, since)
+			if e := closeOut(); err == nil {
+				err = e
+			}
+			if span := t.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(
+					BackupSinceKey.Int64(int64(since)),
+					BackupVersionKey.Int64(int64(version)),
+					BackupBytesKey.Int64(counter.n),
+				)
+			}
+			t.recordBackupBytes(ctx, "backup", counter.n)
+			return err
+		})
+	return
+}
+
+// Restore loads a backup written by Backup, plain badger backups are accepted too.
+// Chunks are verified before being loaded, so a checksum error leaves the chunks read
+// before it loaded.
+func (t *DB) Restore(ctx context.Context, r io.Reader, options ...BackupOption) error {
+	opt := newBackupOption(options)
+	return t.withSpan(ctx, "db.restore", "restore", []byte{},
+		func(ctx context.Context) error {
+			counter := &countingReader{r: r, progress: opt.progress}
+			in, err := openBackupReader(counter)
+			if err != nil {
+				return err
+			}
+			err = t.db.Load(in, restoreMaxPendingWrite)
+			if span := t.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(BackupBytesKey.Int64(counter.n))
+			}
+			t.recordBackupBytes(ctx, "restore", counter.n)
+			return err
+		})
+}
+
+// VerifyBackup reads a whole backup and checks its chunk checksums without loading it.
+func VerifyBackup(r io.Reader) error {
+	in, err := openBackupReader(r)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, in)
+	return err
+}
+
+// BackupToDir writes an incremental backup of the versions after the last backup found
+// in dir, named backup-<since>-<version>-<unix time>.bak, and returns its path and version.
+// A backup without new entries keeps the version of the previous one.
+func (t *DB) BackupToDir(ctx context.Context, dir string, options ...BackupOption) (string, uint64, error) {
+	last, err := LastBackupVersion(dir)
+	if err != nil {
+		return "", 0, err
+	}
+	// badger versions start at 1, since 1 is a full backup
+	since := last + 1
+	tmp, err := os.CreateTemp(dir, ".backup-*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	version, err := t.Backup(ctx, w, since, options...)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if version < last {
+		version = last
+	}
+	path := filepath.Join(dir, fmt.Sprintf("backup-%020d-%020d-%d.bak", since, version, time.Now().Unix()))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+	return path, version, nil
+}
+
+// LastBackupVersion returns the version of the newest backup written by BackupToDir in dir.
+func LastBackupVersion(dir string) (uint64, error) {
+	paths, err := BackupFiles(dir)
+	if err != nil || len(paths) == 0 {
+		return 0, err
+	}
+	_, version, _ := parseBackupName(paths[len(paths)-1])
+	return version, nil
+}
+
+// BackupFiles lists the backups written by BackupToDir in dir, oldest first,
+// restoring them in this order rebuilds the store.
+func BackupFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if _, _, ok := parseBackupName(entry.Name()); ok && !entry.IsDir() {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		si, vi, _ := parseBackupName(paths[i])
+		sj, vj, _ := parseBackupName(paths[j])
+		if vi != vj {
+			return vi < vj
+		}
+		// an empty backup keeps the version of the previous one
+		if si != sj {
+			return si < sj
+		}
+		return paths[i] < paths[j]
+	})
+	return paths, nil
+}
+
+func parseBackupName(path string) (since uint64, version uint64, ok bool) {
+	name := filepath.Base(path)
+	if !strings.HasPrefix(name, "backup-") || !strings.HasSuffix(name, ".bak") {
+		return 0, 0, false
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, "backup-"), ".bak"), "-")
+	if len(parts) != 3 {
+		return 0, 0, false
+	}
+	var err error
+	if since, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return 0, 0, false
+	}
+	if version, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return 0, 0, false
+	}
+	return since, version, true
+}
+
+func (t *DB) recordBackupBytes(ctx context.Context, operation string, n int64) {
+	if !t.MetricEnabled() {
+		return
+	}
+	attrs := append(append(make([]attribute.KeyValue, 0, len(t.attrs)+1), t.attrs...), semconv.DBOperationName(operation))
+	t.backupBytes.Add(ctx, n, metric.WithAttributes(attrs...))
+}
+
+func newBackupOption(options []BackupOption) *backupOption {
+	opt := new(backupOption)
+	for _, o := range options {
+		o(opt)
+	}
+	return opt
+}
+
+// wrapWriter writes the header and stacks the chunk framing and compression on w.
+func (opt *backupOption) wrapWriter(w io.Writer) (io.Writer, func() error, error) {
+	if !opt.compress && !opt.checksum {
+		return w, func() error { return nil }, nil
+	}
+	var flags byte
+	if opt.compress {
+		flags |= backupFlagCompressed
+	}
+	if opt.checksum {
+		flags |= backupFlagChecksum
+	}
+	if _, err := w.Write(append(append([]byte(nil), backupMagic...), flags)); err != nil {
+		return nil, nil, err
+	}
+	var (
+		out     = w
+		closers []func() error
+	)
+	if opt.checksum {
+		cw := &chunkWriter{w: w, buf: make([]byte, 0, backupChunkSize)}
+		out = cw
+		closers = append(closers, cw.Close)
+	}
+	if opt.compress {
+		gz := gzip.NewWriter(out)
+		out = gz
+		closers = append([]func() error{gz.Close}, closers...)
+	}
+	return out, func() error {
+		for _, c := range closers {
+			if err := c(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+func openBackupReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(backupMagic) + 1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(header) <= len(backupMagic) || !bytes.Equal(header[:len(backupMagic)], backupMagic) {
+		return br, nil
+	}
+	flags := header[len(backupMagic)]
+	if _, err := br.Discard(len(header)); err != nil {
+		return nil, err
+	}
+	var in io.Reader = br
+	if flags&backupFlagChecksum != 0 {
+		in = &chunkReader{r: br}
+	}
+	if flags&backupFlagCompressed != 0 {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, err
+		}
+		in = gz
+	}
+	return in, nil
+}
+
+// chunkWriter frames data as [len uint32][data][crc32c uint32], a zero length chunk ends the stream.
+type chunkWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(c.buf[len(c.buf):cap(c.buf)], p)
+		c.buf = c.buf[:len(c.buf)+n]
+		p = p[n:]
+		written += n
+		if len(c.buf) == cap(c.buf) {
+			if err := c.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (c *chunkWriter) flush() error {
+	var head [4]byte
+	binary.BigEndian.PutUint32(head[:], uint32(len(c.buf)))
+	if _, err := c.w.Write(head[:]); err != nil {
+		return err
+	}
+	if len(c.buf) == 0 {
+		return nil
+	}
+	if _, err := c.w.Write(c.buf); err != nil {
+		return err
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.Checksum(c.buf, crcTable))
+	if _, err := c.w.Write(sum[:]); err != nil {
+		return err
+	}
+	c.buf = c.buf[:0]
+	return nil
+}
+
+func (c *chunkWriter) Close() error {
+	if len(c.buf) > 0 {
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+	return c.flush()
+}
+
+type chunkReader struct {
+	r    io.Reader
+	buf  []byte
+	done bool
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		var head [4]byte
+		if _, err := io.ReadFull(c.r, head[:]); err != nil {
+			return 0, errTruncated(err)
+		}
+		size := binary.BigEndian.Uint32(head[:])
+		if size == 0 {
+			c.done = true
+			continue
+		}
+		chunk := make([]byte, size+4)
+		if _, err := io.ReadFull(c.r, chunk); err != nil {
+			return 0, errTruncated(err)
+		}
+		if crc32.Checksum(chunk[:size], crcTable) != binary.BigEndian.Uint32(chunk[size:]) {
+			return 0, ErrBackupChecksum
+		}
+		c.buf = chunk[:size]
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func errTruncated(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type countingWriter struct {
+	w        io.Writer
+	n        int64
+	progress func(int64)
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if c.progress != nil {
+		c.progress(c.n)
+	}
+	return n, err
+}
+
+type countingReader struct {
+	r        io.Reader
+	n        int64
+	progress func(int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.progress != nil && n > 0 {
+		c.progress(c.n)
+	}
+	return n, err
+}
@@ -0,0 +1,64 @@
+package badger_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupToDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	h := badgertest.New(t)
+	set := func(key string, value string) {
+		assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte(key), []byte(value))))
+	}
+
+	set("a", "1")
+	set("b", "1")
+	_, first, err := h.DB.BackupToDir(ctx, dir)
+	assert.NoError(t, err)
+	assert.NotZero(t, first)
+
+	set("a", "2")
+	_, second, err := h.DB.BackupToDir(ctx, dir, badger.WithBackupChecksum(true))
+	assert.NoError(t, err)
+	assert.Greater(t, second, first)
+
+	// nothing new, the version carries over
+	_, third, err := h.DB.BackupToDir(ctx, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, second, third)
+	last, err := badger.LastBackupVersion(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, second, last)
+
+	set("b", "3")
+	_, fourth, err := h.DB.BackupToDir(ctx, dir)
+	assert.NoError(t, err)
+	assert.Greater(t, fourth, third)
+
+	paths, err := badger.BackupFiles(dir)
+	assert.NoError(t, err)
+	assert.Len(t, paths, 4)
+	restored := badgertest.New(t)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, restored.DB.Restore(ctx, f))
+		f.Close()
+	}
+	for key, want := range map[string]string{"a": "2", "b": "3"} {
+		assert.NoError(t, restored.DB.View(ctx, []byte(key), func(value []byte) error {
+			assert.Equal(t, want, string(value), key)
+			return nil
+		}))
+	}
+}
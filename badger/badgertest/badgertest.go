@@ -0,0 +1,188 @@
+// Package badgertest opens badger.DB stores for tests, in memory by default, recording
+// their spans and metrics with in memory OpenTelemetry exporters.
+package badgertest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/XiBao/db/badger"
+	dgbadger "github.com/dgraph-io/badger/v4"
+)
+
+// Harness is an in memory store with tracing and metrics enabled.
+type Harness struct {
+	DB             *badger.DB
+	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  *sdkmetric.MeterProvider
+	spans          *tracetest.InMemoryExporter
+	reader         *sdkmetric.ManualReader
+}
+
+// New opens the store, closed with its providers when tb ends. Options are applied
+// after the ones of the harness.
+func New(tb testing.TB, options ...badger.Option) *Harness {
+	tb.Helper()
+	return Open(tb, badger.InMemoryOptions(context.Background()), options...)
+}
+
+// Open is New with the given badger options, e.g. to test a store on disk.
+func Open(tb testing.TB, opts dgbadger.Options, options ...badger.Option) *Harness {
+	tb.Helper()
+	ctx := context.Background()
+	h := &Harness{
+		spans:  tracetest.NewInMemoryExporter(),
+		reader: sdkmetric.NewManualReader(),
+	}
+	h.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(h.spans))
+	h.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(h.reader))
+	opts = opts.WithLogger(nil)
+	dbOptions := append([]badger.Option{
+		badger.WithTracing(true),
+		badger.WithMetric(true),
+		badger.WithTracerProvider(h.TracerProvider),
+		badger.WithMeterProvider(h.MeterProvider),
+	}, options...)
+	db, err := badger.New(ctx, opts, dbOptions...)
+	if err != nil {
+		tb.Fatalf("badgertest: open store: %v", err)
+	}
+	h.DB = db
+	tb.Cleanup(func() {
+		if err := db.Close(ctx); err != nil {
+			tb.Errorf("badgertest: close store: %v", err)
+		}
+		_ = h.TracerProvider.Shutdown(ctx)
+		_ = h.MeterProvider.Shutdown(ctx)
+	})
+	return h
+}
+
+// Spans returns the ended spans in the order they ended.
+func (h *Harness) Spans() []sdktrace.ReadOnlySpan {
+	return h.spans.GetSpans().Snapshots()
+}
+
+// SpansNamed returns the ended spans named name.
+func (h *Harness) SpansNamed(name string) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range h.Spans() {
+		if span.Name() == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// Reset forgets the spans recorded so far.
+func (h *Harness) Reset() {
+	h.spans.Reset()
+}
+
+// Metrics collects the metrics recorded so far.
+func (h *Harness) Metrics(ctx context.Context) (metricdata.ResourceMetrics, error) {
+	var rm metricdata.ResourceMetrics
+	err := h.reader.Collect(ctx, &rm)
+	return rm, err
+}
+
+// AssertSpan fails tb unless a span named name has all attrs, and returns the first one.
+func (h *Harness) AssertSpan(tb testing.TB, name string, attrs ...attribute.KeyValue) sdktrace.ReadOnlySpan {
+	tb.Helper()
+	spans := h.SpansNamed(name)
+	for _, span := range spans {
+		if HasAttributes(span, attrs...) {
+			return span
+		}
+	}
+	if len(spans) == 0 {
+		tb.Errorf("badgertest: no span named %q, got %s", name, spanNames(h.Spans()))
+	} else {
+		tb.Errorf("badgertest: no span named %q with %v, got %s", name, attrs, spanAttributes(spans))
+	}
+	return nil
+}
+
+// AssertNoSpan fails tb when a span named name was recorded.
+func (h *Harness) AssertNoSpan(tb testing.TB, name string) {
+	tb.Helper()
+	if spans := h.SpansNamed(name); len(spans) > 0 {
+		tb.Errorf("badgertest: %d unexpected spans named %q", len(spans), name)
+	}
+}
+
+// AssertSpanError fails tb unless a span named name recorded an error.
+func (h *Harness) AssertSpanError(tb testing.TB, name string) sdktrace.ReadOnlySpan {
+	tb.Helper()
+	for _, span := range h.SpansNamed(name) {
+		for _, event := range span.Events() {
+			if event.Name == "exception" {
+				return span
+			}
+		}
+	}
+	tb.Errorf("badgertest: no span named %q recorded an error", name)
+	return nil
+}
+
+// AssertMetric fails tb unless the metric named name was recorded, and returns it.
+func (h *Harness) AssertMetric(tb testing.TB, name string) metricdata.Metrics {
+	tb.Helper()
+	rm, err := h.Metrics(context.Background())
+	if err != nil {
+		tb.Errorf("badgertest: collect metrics: %v", err)
+		return metricdata.Metrics{}
+	}
+	var names []string
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m
+			}
+			names = append(names, m.Name)
+		}
+	}
+	tb.Errorf("badgertest: no metric named %q, got %v", name, names)
+	return metricdata.Metrics{}
+}
+
+// HasAttributes reports whether span has all attrs.
+func HasAttributes(span sdktrace.ReadOnlySpan, attrs ...attribute.KeyValue) bool {
+	got := attribute.NewSet(span.Attributes()...)
+	for _, attr := range attrs {
+		if v, ok := got.Value(attr.Key); !ok || v != attr.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func spanNames(spans []sdktrace.ReadOnlySpan) string {
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	return fmt.Sprintf("%v", names)
+}
+
+func spanAttributes(spans []sdktrace.ReadOnlySpan) string {
+	var b strings.Builder
+	for _, span := range spans {
+		b.WriteString("\n\t")
+		for i, attr := range span.Attributes() {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%s=%s", attr.Key, attr.Value.Emit())
+		}
+	}
+	return b.String()
+}
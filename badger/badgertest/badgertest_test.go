@@ -0,0 +1,34 @@
+package badgertest_test
+
+import (
+	"context"
+	"testing"
+
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/XiBao/db/badger/badgertest"
+	"github.com/XiBao/db/model"
+)
+
+func TestHarness(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("k"), []byte("v"))))
+	h.AssertSpan(t, "db.update",
+		semconv.DBOperationName("update"),
+		semconv.DBQueryText("k"),
+		semconv.DBSystemKey.String("badger"),
+	)
+
+	err := h.DB.View(ctx, []byte("missing"), func([]byte) error { return nil })
+	assert.ErrorIs(t, err, model.ErrNotFound)
+	h.AssertSpanError(t, "db.view")
+	h.AssertNoSpan(t, "db.delete")
+	h.AssertMetric(t, semconv.DBClientOperationDurationName)
+
+	h.Reset()
+	assert.Empty(t, h.Spans())
+}
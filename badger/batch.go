@@ -0,0 +1,159 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	BatchEntriesKey = attribute.Key("db.badger.batch.entries")
+	BatchBytesKey   = attribute.Key("db.badger.batch.bytes")
+)
+
+var ErrBatchClosed = errors.New("batch writer closed")
+
+type batchOption struct {
+	flushEntries int
+	flushBytes   int64
+}
+
+type BatchOption = func(opt *batchOption)
+
+// WithFlushEntries flushes the batch every n entries.
+func WithFlushEntries(n int) BatchOption {
+	return func(opt *batchOption) {
+		opt.flushEntries = n
+	}
+}
+
+// WithFlushBytes flushes the batch once n bytes of keys and values are pending.
+func WithFlushBytes(n int64) BatchOption {
+	return func(opt *batchOption) {
+		opt.flushBytes = n
+	}
+}
+
+// BatchWriter writes entries through badger's WriteBatch, which splits them into as
+// many transactions as needed, so the writes are not atomic as a whole.
+type BatchWriter struct {
+	db           *DB
+	option       *batchOption
+	mu           sync.Mutex
+	wb           *badger.WriteBatch
+	pending      int
+	pendingBytes int64
+	entries      int
+	bytes        int64
+	err          error
+	closed       bool
+}
+
+func (t *DB) NewBatchWriter(options ...BatchOption) *BatchWriter {
+	ret := &BatchWriter{
+		db:     t,
+		option: new(batchOption),
+		wb:     t.db.NewWriteBatch(),
+	}
+	for _, opt := range options {
+		opt(ret.option)
+	}
+	return ret
+}
+
+func (b *BatchWriter) SetEntry(ctx context.Context, entry *badger.Entry) error {
+	return b.write(ctx, int64(len(entry.Key)+len(entry.Value)), func(wb *badger.WriteBatch) error {
+		return wb.SetEntry(entry)
+	})
+}
+
+func (b *BatchWriter) Set(ctx context.Context, key []byte, value []byte) error {
+	return b.SetEntry(ctx, badger.NewEntry(key, value))
+}
+
+func (b *BatchWriter) Delete(ctx context.Context, key []byte) error {
+	return b.write(ctx, int64(len(key)), func(wb *badger.WriteBatch) error {
+		return wb.Delete(key)
+	})
+}
+
+func (b *BatchWriter) write(ctx context.Context, size int64, fn func(wb *badger.WriteBatch) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBatchClosed
+	}
+	if err := fn(b.wb); err != nil {
+		b.err = errors.Join(b.err, err)
+		return err
+	}
+	b.pending++
+	b.pendingBytes += size
+	if (b.option.flushEntries > 0 && b.pending >= b.option.flushEntries) ||
+		(b.option.flushBytes > 0 && b.pendingBytes >= b.option.flushBytes) {
+		return b.flush(ctx, false)
+	}
+	return nil
+}
+
+// Flush commits the pending entries, the writer stays usable.
+func (b *BatchWriter) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBatchClosed
+	}
+	return b.flush(ctx, false)
+}
+
+// Close flushes the pending entries and returns every error met by the writer.
+func (b *BatchWriter) Close(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBatchClosed
+	}
+	b.closed = true
+	// flush joins its error into b.err
+	_ = b.flush(ctx, true)
+	return b.err
+}
+
+// Entries returns the number of entries flushed so far.
+func (b *BatchWriter) Entries() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.entries
+}
+
+// Bytes returns the size of the keys and values flushed so far.
+func (b *BatchWriter) Bytes() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bytes
+}
+
+func (b *BatchWriter) flush(ctx context.Context, last bool) error {
+	return b.db.withSpan(ctx, "db.batch.flush", "batch", []byte{},
+		func(ctx context.Context) error {
+			err := b.wb.Flush()
+			if err == nil {
+				b.entries += b.pending
+				b.bytes += b.pendingBytes
+			} else {
+				b.err = errors.Join(b.err, err)
+			}
+			b.pending = 0
+			b.pendingBytes = 0
+			if !last {
+				b.wb = b.db.db.NewWriteBatch()
+			}
+			if span := b.db.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(BatchEntriesKey.Int(b.entries), BatchBytesKey.Int64(b.bytes))
+			}
+			return err
+		})
+}
@@ -0,0 +1,67 @@
+package badger_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	"github.com/XiBao/db/model"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchWriter(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	b := h.DB.NewBatchWriter(badger.WithFlushEntries(10))
+	for i := range 25 {
+		assert.NoError(t, b.Set(ctx, []byte(fmt.Sprintf("k%02d", i)), []byte("vv")))
+	}
+	assert.NoError(t, b.Delete(ctx, []byte("k00")))
+	// two automatic flushes of 10 entries, the rest is pending
+	assert.Equal(t, 20, b.Entries())
+	assert.Len(t, h.SpansNamed("db.batch.flush"), 2)
+
+	assert.NoError(t, b.Close(ctx))
+	assert.Equal(t, 26, b.Entries())
+	assert.Equal(t, int64(25*5+3), b.Bytes())
+	h.AssertSpan(t, "db.batch.flush", badger.BatchEntriesKey.Int(26))
+	assert.ErrorIs(t, h.DB.View(ctx, []byte("k00"), func([]byte) error { return nil }), model.ErrNotFound)
+	assert.Len(t, scanKeys(t, h.DB, nil), 24)
+
+	assert.ErrorIs(t, b.Set(ctx, []byte("late"), []byte("v")), badger.ErrBatchClosed)
+	assert.ErrorIs(t, b.Flush(ctx), badger.ErrBatchClosed)
+	assert.ErrorIs(t, b.Close(ctx), badger.ErrBatchClosed)
+}
+
+func TestBatchWriterCloseReturnsEveryError(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	b := h.DB.NewBatchWriter()
+	assert.Error(t, b.Set(ctx, []byte{}, []byte("v")))
+	assert.NoError(t, b.Set(ctx, []byte("k"), []byte("v")))
+	// the final flush succeeds, the earlier error is still reported
+	assert.ErrorIs(t, b.Close(ctx), dgbadger.ErrEmptyKey)
+	assert.Equal(t, 1, b.Entries())
+}
+
+func TestUpdateEntries(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	assert.NoError(t, h.DB.Update(ctx))
+	assert.NoError(t, h.DB.Update(ctx,
+		dgbadger.NewEntry([]byte("a"), []byte("1")),
+		dgbadger.NewEntry([]byte("b"), []byte("2")),
+		dgbadger.NewEntry([]byte("c"), []byte("3"))))
+	assert.Equal(t, []string{"a", "b", "c"}, scanKeys(t, h.DB, nil))
+	h.AssertSpan(t, "db.update", badger.BatchEntriesKey.Int(3))
+
+	// an invalid entry fails the whole transaction
+	err := h.DB.Update(ctx,
+		dgbadger.NewEntry([]byte("d"), []byte("4")),
+		dgbadger.NewEntry([]byte{}, []byte("5")))
+	assert.Error(t, err)
+	assert.ErrorIs(t, h.DB.View(ctx, []byte("d"), func([]byte) error { return nil }), model.ErrNotFound)
+}
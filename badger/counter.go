@@ -0,0 +1,193 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/maphash"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var DeltaKey = attribute.Key("db.badger.delta")
+
+var ErrNotCounter = errors.New("value is not a counter")
+
+// counterStripes is the number of locks serializing the Incr of a DB, keys are spread
+// over them by hash.
+const counterStripes = 64
+
+// EncodeCounter encodes n the way Incr and MergeAdd store counters, 8 bytes big endian.
+func EncodeCounter(n int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(n))
+}
+
+// DecodeCounter decodes a counter, an empty value is 0.
+func DecodeCounter(value []byte) (int64, error) {
+	switch len(value) {
+	case 0:
+		return 0, nil
+	case 8:
+		return int64(binary.BigEndian.Uint64(value)), nil
+	}
+	return 0, ErrNotCounter
+}
+
+// Incr adds delta to the counter stored at key, missing keys count from 0, and returns
+// the new value. The increments of a DB are serialized per key, so they do not depend on
+// DetectConflicts, other writes of the key conflicting with one are retried. Use a
+// MergeOperator for keys incremented by many concurrent goroutines or independent
+// writers, which then do not wait for each other.
+func (t *DB) Incr(ctx context.Context, key []byte, delta int64) (value int64, err error) {
+	err = t.withSpan(ctx, "db.incr", "incr", key,
+		func(ctx context.Context) error {
+			if span := t.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(DeltaKey.Int64(delta))
+			}
+			mu := &t.counters[maphash.Bytes(t.counterSeed, key)%counterStripes]
+			mu.Lock()
+			defer mu.Unlock()
+			return t.updateWithRetry(ctx, func(txn *badger.Txn) error {
+				var current int64
+				item, err := txn.Get(key)
+				if err == nil {
+					if err := item.Value(func(val []byte) error {
+						current, err = DecodeCounter(val)
+						return err
+					}); err != nil {
+						return err
+					}
+				} else if !errors.Is(err, badger.ErrKeyNotFound) {
+					return mapError(err)
+				}
+				value = current + delta
+				entry := badger.NewEntry(key, EncodeCounter(value))
+				if item != nil {
+					entry.ExpiresAt = item.ExpiresAt()
+				}
+				return txn.SetEntry(entry)
+			})
+		})
+	return
+}
+
+func (t *DB) Decr(ctx context.Context, key []byte, delta int64) (int64, error) {
+	return t.Incr(ctx, key, -delta)
+}
+
+// MergeFunc merges value into existing, see badger.MergeFunc.
+type MergeFunc = badger.MergeFunc
+
+// MergeAdd adds counters encoded by EncodeCounter.
+func MergeAdd(existing, value []byte) []byte {
+	a, _ := DecodeCounter(existing)
+	b, _ := DecodeCounter(value)
+	return EncodeCounter(a + b)
+}
+
+// MergeUnion unions sets encoded by EncodeSet.
+func MergeUnion(existing, value []byte) []byte {
+	a, _ := DecodeSet(existing)
+	b, _ := DecodeSet(value)
+	return EncodeSet(append(a, b...))
+}
+
+// EncodeSet encodes the distinct members sorted, each prefixed by its uvarint length.
+func EncodeSet(members [][]byte) []byte {
+	sort.Slice(members, func(i, j int) bool {
+		return bytes.Compare(members[i], members[j]) < 0
+	})
+	var buf []byte
+	for i, member := range members {
+		if i > 0 && bytes.Equal(member, members[i-1]) {
+			continue
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(member)))
+		buf = append(buf, member...)
+	}
+	return buf
+}
+
+func DecodeSet(value []byte) ([][]byte, error) {
+	var members [][]byte
+	for len(value) > 0 {
+		n, size := binary.Uvarint(value)
+		if size <= 0 || uint64(len(value)-size) < n {
+			return members, errors.New("invalid set encoding")
+		}
+		value = value[size:]
+		members = append(members, value[:n:n])
+		value = value[n:]
+	}
+	return members, nil
+}
+
+// MergeOperator accumulates values added to one key, merged by a background goroutine
+// every interval and when read. It is stopped by Stop or DB.Close.
+type MergeOperator struct {
+	db  *DB
+	key []byte
+	op  *badger.MergeOperator
+}
+
+// NewMergeOperator starts a merge operator of key merging with fn, e.g. MergeAdd.
+func (t *DB) NewMergeOperator(key []byte, fn MergeFunc, interval time.Duration) *MergeOperator {
+	m := &MergeOperator{
+		db:  t,
+		key: key,
+		op:  t.db.GetMergeOperator(key, fn, interval),
+	}
+	t.mergeMu.Lock()
+	t.merges[m] = struct{}{}
+	t.mergeMu.Unlock()
+	return m
+}
+
+// Add queues value for the next merge. Add is meant for hot paths and only appends to
+// the store, so it is only traced within a recording span of ctx, the merges show in
+// the spans of Get.
+func (m *MergeOperator) Add(ctx context.Context, value []byte) error {
+	if !m.db.TracingEnabled() || !trace.SpanFromContext(ctx).IsRecording() {
+		return m.op.Add(value)
+	}
+	return m.db.withSpan(ctx, "db.merge.add", "merge", m.key,
+		func(ctx context.Context) error {
+			return m.op.Add(value)
+		})
+}
+
+// Get returns the merge of every value added so far, model.ErrNotFound before the first Add.
+func (m *MergeOperator) Get(ctx context.Context) (value []byte, err error) {
+	err = m.db.withSpan(ctx, "db.merge.get", "merge", m.key,
+		func(ctx context.Context) error {
+			value, err = m.op.Get()
+			return mapError(err)
+		})
+	return
+}
+
+// Stop waits for the running merge and stops the background goroutine.
+func (m *MergeOperator) Stop() {
+	m.db.mergeMu.Lock()
+	_, ok := m.db.merges[m]
+	delete(m.db.merges, m)
+	m.db.mergeMu.Unlock()
+	if ok {
+		m.op.Stop()
+	}
+}
+
+func (t *DB) stopMergeOperators() {
+	t.mergeMu.Lock()
+	merges := t.merges
+	t.merges = make(map[*MergeOperator]struct{})
+	t.mergeMu.Unlock()
+	for m := range merges {
+		m.op.Stop()
+	}
+}
@@ -0,0 +1,77 @@
+package badger_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncr(t *testing.T) {
+	ctx := context.Background()
+	for name, detect := range map[string]bool{"conflicts": true, "no conflicts": false} {
+		t.Run(name, func(t *testing.T) {
+			h := badgertest.Open(t, badger.InMemoryOptions(ctx).WithDetectConflicts(detect))
+			var wg sync.WaitGroup
+			for range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range 100 {
+						_, err := h.DB.Incr(ctx, []byte("hits"), 1)
+						assert.NoError(t, err)
+					}
+				}()
+			}
+			wg.Wait()
+			value, err := h.DB.Decr(ctx, []byte("hits"), 10)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(790), value)
+		})
+	}
+}
+
+func TestIncrKeepsExpiry(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("hits"), badger.EncodeCounter(41)).WithTTL(time.Hour)))
+	value, err := h.DB.Incr(ctx, []byte("hits"), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), value)
+	ttl, err := h.DB.GetTTL(ctx, []byte("hits"))
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("name"), []byte("text"))))
+	_, err = h.DB.Incr(ctx, []byte("name"), 1)
+	assert.ErrorIs(t, err, badger.ErrNotCounter)
+}
+
+func TestMergeOperator(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	m := h.DB.NewMergeOperator([]byte("total"), badger.MergeAdd, time.Hour)
+	defer m.Stop()
+	for _, n := range []int64{1, 2, 3} {
+		assert.NoError(t, m.Add(ctx, badger.EncodeCounter(n)))
+	}
+	value, err := m.Get(ctx)
+	assert.NoError(t, err)
+	total, err := badger.DecodeCounter(value)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), total)
+	h.AssertNoSpan(t, "db.merge.add")
+	h.AssertSpan(t, "db.merge.get")
+
+	// traced within a recording span only
+	parentCtx, parent := h.TracerProvider.Tracer("test").Start(ctx, "parent")
+	assert.NoError(t, m.Add(parentCtx, badger.EncodeCounter(4)))
+	parent.End()
+	add := h.AssertSpan(t, "db.merge.add")
+	assert.Equal(t, parent.SpanContext().SpanID(), add.Parent().SpanID())
+}
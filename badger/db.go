@@ -3,6 +3,9 @@ package badger
 import (
 	"context"
 	"encoding/hex"
+	"errors"
+	"hash/maphash"
+	"sync"
 	"time"
 	"unicode/utf8"
 
@@ -30,12 +33,25 @@ type DB struct {
 	meterProvider  metric.MeterProvider
 	meter          metric.Meter
 	queryHistogram metric.Int64Histogram
+	backupBytes    metric.Int64Counter
+	gc             *gcRunner
+	prefixReport   *prefixReporter
+	metrics        *internalMetrics
+	mergeMu        sync.Mutex
+	merges         map[*MergeOperator]struct{}
+	seqMu          sync.Mutex
+	sequences      map[*Sequence]struct{}
+	counters       [counterStripes]sync.Mutex
+	counterSeed    maphash.Seed
 	attrs          []attribute.KeyValue
 }
 
 func New(ctx context.Context, options badger.Options, dbOptions ...Option) (*DB, error) {
 	ret := &DB{
 		option:        new(option),
+		merges:        make(map[*MergeOperator]struct{}),
+		sequences:     make(map[*Sequence]struct{}),
+		counterSeed:   maphash.MakeSeed(),
 		traceProvider: otel.GetTracerProvider(),
 		meterProvider: otel.GetMeterProvider(),
 		attrs: []attribute.KeyValue{
@@ -46,6 +62,12 @@ func New(ctx context.Context, options badger.Options, dbOptions ...Option) (*DB,
 	for _, opt := range dbOptions {
 		opt(ret.option)
 	}
+	if ret.option.traceProvider != nil {
+		ret.traceProvider = ret.option.traceProvider
+	}
+	if ret.option.meterProvider != nil {
+		ret.meterProvider = ret.option.meterProvider
+	}
 	ret.tracer = ret.traceProvider.Tracer(instrumName)
 	ret.meter = ret.meterProvider.Meter(instrumName)
 	if histogram, err := ret.meter.Int64Histogram(
@@ -57,10 +79,24 @@ func New(ctx context.Context, options badger.Options, dbOptions ...Option) (*DB,
 	} else {
 		ret.queryHistogram = histogram
 	}
+	if counter, err := ret.meter.Int64Counter("db.badger.backup.bytes",
+		metric.WithDescription("Bytes written by backups and read by restores"),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, err
+	} else {
+		ret.backupBytes = counter
+	}
+	if ret.option.internalMetrics {
+		options.MetricsEnabled = true
+	}
+	if ret.option.versions > 0 {
+		options.NumVersionsToKeep = ret.option.versions
+	}
 	if err := ret.withSpan(ctx, "db.connect", "connect", nil,
 		func(ctx context.Context) error {
 			if conn, err := badger.Open(options); err != nil {
-				return err
+				return encryptionError(options.Dir, err)
 			} else {
 				ret.db = conn
 			}
@@ -68,6 +104,36 @@ func New(ctx context.Context, options badger.Options, dbOptions ...Option) (*DB,
 		}); err != nil {
 		return nil, err
 	}
+	if gc, err := newGCRunner(ret); err != nil {
+		ret.db.Close()
+		return nil, err
+	} else {
+		ret.gc = gc
+	}
+	if ret.option.internalMetrics {
+		if metrics, err := registerInternalMetrics(ret); err != nil {
+			ret.db.Close()
+			return nil, err
+		} else {
+			ret.metrics = metrics
+		}
+	}
+	if ret.option.prefixReport != nil {
+		if r, err := newPrefixReporter(ret, *ret.option.prefixReport); err != nil {
+			ret.metrics.unregister()
+			ret.db.Close()
+			return nil, err
+		} else {
+			ret.prefixReport = r
+		}
+	}
+	// an in-memory store has no value log to collect
+	if ret.option.gc != nil && !options.InMemory {
+		ret.gc.start(ctx)
+	}
+	if ret.prefixReport != nil {
+		ret.prefixReport.start(ctx)
+	}
 	return ret, nil
 }
 
@@ -83,6 +149,14 @@ func (t *DB) MetricEnabled() bool {
 	return t.option != nil && t.option.enableMetric
 }
 
+// span returns the span started by withSpan for ctx, nil when tracing is disabled.
+func (t *DB) span(ctx context.Context) trace.Span {
+	if !t.TracingEnabled() {
+		return nil
+	}
+	return trace.SpanFromContext(ctx)
+}
+
 func (t *DB) withSpan(
 	ctx context.Context,
 	spanName string,
@@ -131,6 +205,9 @@ func (t *DB) withSpan(
 	return err
 }
 
+// GC blocks running BadgerGC until ctx is done.
+//
+// Deprecated: use WithGC, the GC then runs in the background with one span per cycle.
 func (t *DB) GC(ctx context.Context, options *BadgerGCOptions) error {
 	return t.withSpan(ctx, "db.gc", "gc", nil,
 		func(ctx context.Context) error {
@@ -142,7 +219,12 @@ func (t *DB) GC(ctx context.Context, options *BadgerGCOptions) error {
 func (t *DB) Close(ctx context.Context) error {
 	return t.withSpan(ctx, "db.close", "close", nil,
 		func(ctx context.Context) error {
-			return t.db.Close()
+			t.gc.stop()
+			reportErr := t.prefixReport.stop()
+			t.stopMergeOperators()
+			// a failed release does not keep the store open, the leased range is only lost
+			seqErr := t.releaseSequences()
+			return errors.Join(reportErr, seqErr, t.metrics.unregister(), t.db.Close())
 		})
 }
 
@@ -153,11 +235,23 @@ func (t *DB) Commit(ctx context.Context, txn *badger.Txn) error {
 		})
 }
 
-func (t *DB) Update(ctx context.Context, entry *badger.Entry) error {
-	return t.withSpan(ctx, "db.update", "update", entry.Key,
+// Update writes the entries atomically in one transaction, retried on badger.ErrConflict.
+func (t *DB) Update(ctx context.Context, entries ...*badger.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return t.withSpan(ctx, "db.update", "update", entries[0].Key,
 		func(ctx context.Context) error {
-			return t.db.Update(func(txn *badger.Txn) error {
-				return txn.SetEntry(entry)
+			if span := t.span(ctx); span != nil && span.IsRecording() && len(entries) > 1 {
+				span.SetAttributes(BatchEntriesKey.Int(len(entries)))
+			}
+			return t.updateWithRetry(ctx, func(txn *badger.Txn) error {
+				for _, entry := range entries {
+					if err := txn.SetEntry(entry); err != nil {
+						return err
+					}
+				}
+				return nil
 			})
 		})
 }
@@ -177,12 +271,7 @@ func (t *DB) View(ctx context.Context, key []byte, callback func([]byte) error)
 			return t.db.View(func(txn *badger.Txn) error {
 				item, err := txn.Get(key)
 				if err != nil {
-					if err == badger.ErrKeyNotFound {
-						return model.ErrNotFound
-					} else if err == badger.ErrEmptyKey {
-						return model.ErrEmptyKey
-					}
-					return err
+					return mapError(err)
 				}
 				return item.Value(callback)
 			})
@@ -194,12 +283,7 @@ func (t *DB) Get(ctx context.Context, txn *badger.Txn, key []byte) (value []byte
 		func(ctx context.Context) error {
 			item, err := txn.Get(key)
 			if err != nil {
-				if err == badger.ErrKeyNotFound {
-					return model.ErrNotFound
-				} else if err == badger.ErrEmptyKey {
-					return model.ErrEmptyKey
-				}
-				return err
+				return mapError(err)
 			}
 			if val, err := item.ValueCopy(nil); err != nil {
 				return err
@@ -215,6 +299,18 @@ func (t *DB) NewTransaction(update bool) *badger.Txn {
 	return t.db.NewTransaction(update)
 }
 
+// mapError converts badger key errors to the model errors shared with nutsdb.
+func mapError(err error) error {
+	if err == badger.ErrKeyNotFound {
+		return model.ErrNotFound
+	} else if err == badger.ErrEmptyKey {
+		return model.ErrEmptyKey
+	} else if err == badger.ErrZeroBandwidth {
+		return model.ErrZeroBandwidth
+	}
+	return err
+}
+
 func safeString(bs []byte) string {
 	if bs == nil {
 		return ""
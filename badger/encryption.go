@@ -0,0 +1,161 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	DefaultEncryptionKeyRotation = 10 * 24 * time.Hour
+	// DefaultEncryptionIndexCacheSize is used when encryption is enabled without index cache,
+	// which badger requires.
+	DefaultEncryptionIndexCacheSize = 100 << 20
+)
+
+var (
+	ErrInvalidEncryptionKey = errors.New("encryption key must be 16, 24 or 32 bytes for AES-128, AES-192 or AES-256")
+	ErrWrongEncryptionKey   = errors.New("wrong encryption key")
+)
+
+// EncryptionKeyError is returned by New when the store can not be opened with the
+// configured encryption key, it matches ErrWrongEncryptionKey.
+type EncryptionKeyError struct {
+	Dir string
+	Err error
+}
+
+func (e *EncryptionKeyError) Error() string {
+	return fmt.Sprintf("badger store %s: %s: %v", e.Dir, ErrWrongEncryptionKey, e.Err)
+}
+
+func (e *EncryptionKeyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *EncryptionKeyError) Is(target error) bool {
+	return target == ErrWrongEncryptionKey
+}
+
+// KeyProvider returns the master key badger encrypts its data keys with.
+type KeyProvider interface {
+	EncryptionKey(ctx context.Context) ([]byte, error)
+}
+
+// KeyProviderFunc makes a KeyProvider of a callback, e.g. reading a KMS.
+type KeyProviderFunc func(ctx context.Context) ([]byte, error)
+
+func (f KeyProviderFunc) EncryptionKey(ctx context.Context) ([]byte, error) {
+	return f(ctx)
+}
+
+// EnvKeyProvider reads the key hex or base64 encoded from the environment variable name.
+func EnvKeyProvider(name string) KeyProvider {
+	return KeyProviderFunc(func(ctx context.Context) ([]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("encryption key: %s is not set", name)
+		}
+		return decodeEncryptionKey([]byte(value))
+	})
+}
+
+// FileKeyProvider reads the key from path, hex or base64 encoded or raw.
+func FileKeyProvider(path string) KeyProvider {
+	return KeyProviderFunc(func(ctx context.Context) ([]byte, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return decodeEncryptionKey(data)
+	})
+}
+
+// ValidateEncryptionKey checks the key has an AES key size.
+func ValidateEncryptionKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	}
+	return ErrInvalidEncryptionKey
+}
+
+// WithEncryption returns options encrypting the store with the key of provider,
+// rotating the data keys every rotation, DefaultEncryptionKeyRotation when 0.
+func WithEncryption(ctx context.Context, opts badger.Options, provider KeyProvider, rotation time.Duration) (badger.Options, error) {
+	key, err := provider.EncryptionKey(ctx)
+	if err != nil {
+		return opts, err
+	}
+	if err := ValidateEncryptionKey(key); err != nil {
+		return opts, err
+	}
+	if rotation <= 0 {
+		rotation = DefaultEncryptionKeyRotation
+	}
+	opts.EncryptionKey = key
+	opts.EncryptionKeyRotationDuration = rotation
+	if opts.IndexCacheSize <= 0 {
+		opts.IndexCacheSize = DefaultEncryptionIndexCacheSize
+	}
+	return opts, nil
+}
+
+// RekeyStore re-encrypts the data keys of the closed store in dir with the key of newKey,
+// the data itself is not rewritten.
+func RekeyStore(ctx context.Context, dir string, oldKey KeyProvider, newKey KeyProvider) error {
+	oldValue, err := oldKey.EncryptionKey(ctx)
+	if err != nil {
+		return err
+	}
+	newValue, err := newKey.EncryptionKey(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ValidateEncryptionKey(newValue); err != nil {
+		return err
+	}
+	opt := badger.KeyRegistryOptions{
+		Dir:                           dir,
+		ReadOnly:                      true,
+		EncryptionKey:                 oldValue,
+		EncryptionKeyRotationDuration: DefaultEncryptionKeyRotation,
+	}
+	registry, err := badger.OpenKeyRegistry(opt)
+	if err != nil {
+		return encryptionError(dir, err)
+	}
+	defer registry.Close()
+	opt.EncryptionKey = newValue
+	return badger.WriteKeyRegistry(registry, opt)
+}
+
+// encryptionError types the errors of badger about a wrong encryption key.
+func encryptionError(dir string, err error) error {
+	if errors.Is(err, badger.ErrEncryptionKeyMismatch) || errors.Is(err, badger.ErrInvalidEncryptionKey) {
+		return &EncryptionKeyError{Dir: dir, Err: err}
+	}
+	return err
+}
+
+// decodeEncryptionKey prefers the hex and base64 forms of the key to its raw bytes.
+func decodeEncryptionKey(data []byte) ([]byte, error) {
+	text := string(bytes.TrimSpace(data))
+	if key, err := hex.DecodeString(text); err == nil && ValidateEncryptionKey(key) == nil {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && ValidateEncryptionKey(key) == nil {
+		return key, nil
+	}
+	if err := ValidateEncryptionKey(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
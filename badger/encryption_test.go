@@ -0,0 +1,87 @@
+package badger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/XiBao/db/badger"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func openEncrypted(ctx context.Context, dir string, key []byte) (*badger.DB, error) {
+	opts, err := badger.WithEncryption(ctx, dgbadger.DefaultOptions(dir).WithLogger(nil), staticKey(key), 0)
+	if err != nil {
+		return nil, err
+	}
+	return badger.New(ctx, opts)
+}
+
+func staticKey(key []byte) badger.KeyProvider {
+	return badger.KeyProviderFunc(func(ctx context.Context) ([]byte, error) {
+		return key, nil
+	})
+}
+
+func TestEncryptionRekey(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	db, err := openEncrypted(ctx, dir, oldKey)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, db.Update(ctx, dgbadger.NewEntry([]byte("k"), []byte("v"))))
+	assert.NoError(t, db.Close(ctx))
+
+	_, err = openEncrypted(ctx, dir, newKey)
+	assert.ErrorIs(t, err, badger.ErrWrongEncryptionKey)
+	var keyErr *badger.EncryptionKeyError
+	if assert.ErrorAs(t, err, &keyErr) {
+		assert.Equal(t, dir, keyErr.Dir)
+	}
+
+	// the old key must be the one of the store
+	assert.ErrorIs(t, badger.RekeyStore(ctx, dir, staticKey(newKey), staticKey(oldKey)), badger.ErrWrongEncryptionKey)
+	assert.ErrorIs(t, badger.RekeyStore(ctx, dir, staticKey(oldKey), staticKey([]byte("short"))), badger.ErrInvalidEncryptionKey)
+
+	assert.NoError(t, badger.RekeyStore(ctx, dir, staticKey(oldKey), staticKey(newKey)))
+	db, err = openEncrypted(ctx, dir, newKey)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, db.View(ctx, []byte("k"), func(val []byte) error {
+		assert.Equal(t, "v", string(val))
+		return nil
+	}))
+	assert.NoError(t, db.Close(ctx))
+
+	_, err = openEncrypted(ctx, dir, oldKey)
+	assert.ErrorIs(t, err, badger.ErrWrongEncryptionKey)
+}
+
+func TestKeyProviders(t *testing.T) {
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{7}, 16)
+	path := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600))
+	got, err := badger.FileKeyProvider(path).EncryptionKey(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, key, got)
+
+	t.Setenv("TEST_BADGER_KEY", "BwcHBwcHBwcHBwcHBwcHBw==")
+	got, err = badger.EnvKeyProvider("TEST_BADGER_KEY").EncryptionKey(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, key, got)
+
+	_, err = badger.EnvKeyProvider("TEST_BADGER_MISSING_KEY").EncryptionKey(ctx)
+	assert.Error(t, err)
+	_, err = badger.WithEncryption(ctx, dgbadger.DefaultOptions(""), staticKey(key[:10]), 0)
+	assert.ErrorIs(t, err, badger.ErrInvalidEncryptionKey)
+}
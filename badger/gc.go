@@ -0,0 +1,199 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	GCRewritesKey  = attribute.Key("db.badger.gc.rewrites")
+	GCReclaimedKey = attribute.Key("db.badger.gc.reclaimed_bytes")
+)
+
+// GCResult summarizes one value log GC run.
+type GCResult struct {
+	Rewrites int
+	// ReclaimedBytes is how much the value log files shrank during the run.
+	ReclaimedBytes int64
+	Duration       time.Duration
+}
+
+// WithGC runs the value log GC in the background from New until Close, except on
+// in-memory stores.
+func WithGC(options BadgerGCOptions) Option {
+	return func(opt *option) {
+		opt.gc = &options
+	}
+}
+
+type gcRunner struct {
+	db        *DB
+	options   BadgerGCOptions
+	mu        sync.Mutex
+	paused    atomic.Bool
+	cancel    context.CancelFunc
+	done      chan struct{}
+	runs      metric.Int64Counter
+	rewrites  metric.Int64Counter
+	reclaimed metric.Int64Counter
+	duration  metric.Int64Histogram
+}
+
+func newGCRunner(t *DB) (*gcRunner, error) {
+	ret := &gcRunner{db: t, options: DefaultBadgerGCOptions}
+	if t.option.gc != nil {
+		ret.options = *t.option.gc
+	}
+	// zero values would busy-loop or be rejected by badger
+	if ret.options.GCDiscardRatio <= 0 || ret.options.GCDiscardRatio >= 1 {
+		ret.options.GCDiscardRatio = DefaultBadgerGCOptions.GCDiscardRatio
+	}
+	if ret.options.GCInterval <= 0 {
+		ret.options.GCInterval = DefaultBadgerGCOptions.GCInterval
+	}
+	if ret.options.GCSleep <= 0 {
+		ret.options.GCSleep = DefaultBadgerGCOptions.GCSleep
+	}
+	var err error
+	if ret.runs, err = t.meter.Int64Counter("db.badger.gc.runs",
+		metric.WithDescription("Number of value log GC runs"),
+		metric.WithUnit("{run}"),
+	); err != nil {
+		return nil, err
+	}
+	if ret.rewrites, err = t.meter.Int64Counter("db.badger.gc.rewrites",
+		metric.WithDescription("Number of value log files rewritten by GC"),
+		metric.WithUnit("{file}"),
+	); err != nil {
+		return nil, err
+	}
+	if ret.reclaimed, err = t.meter.Int64Counter("db.badger.gc.reclaimed",
+		metric.WithDescription("Value log bytes reclaimed by GC"),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, err
+	}
+	if ret.duration, err = t.meter.Int64Histogram("db.badger.gc.duration",
+		metric.WithDescription("Duration of value log GC runs"),
+		metric.WithUnit("ms"),
+	); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (g *gcRunner) start(ctx context.Context) {
+	ctx, g.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	g.done = make(chan struct{})
+	go g.loop(ctx)
+}
+
+func (g *gcRunner) stop() {
+	if g.cancel == nil {
+		return
+	}
+	g.cancel()
+	<-g.done
+}
+
+func (g *gcRunner) loop(ctx context.Context) {
+	defer close(g.done)
+	t := time.NewTimer(g.options.GCInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if g.paused.Load() {
+				t.Reset(g.options.GCInterval)
+				continue
+			}
+			result, err := g.run(ctx, false)
+			switch {
+			case errors.Is(err, badger.ErrDBClosed):
+				return
+			case err != nil:
+				g.db.db.Opts().Logger.Errorf("error during a GC cycle %s", err)
+				t.Reset(g.options.GCInterval)
+			case result.Rewrites > 0:
+				t.Reset(g.options.GCSleep)
+			default:
+				t.Reset(g.options.GCInterval)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run does one GC run, a single rewrite attempt or, when exhaust is true,
+// as many rewrites as the value log allows.
+func (g *gcRunner) run(ctx context.Context, exhaust bool) (result GCResult, err error) {
+	if g.db.db.Opts().InMemory {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	err = g.db.withSpan(ctx, "db.gc.cycle", "gc", nil,
+		func(ctx context.Context) error {
+			startTime := time.Now()
+			before, err := g.db.vlogSize()
+			if err != nil {
+				return err
+			}
+			for {
+				err = g.db.db.RunValueLogGC(g.options.GCDiscardRatio)
+				if err != nil {
+					break
+				}
+				result.Rewrites++
+				if !exhaust {
+					break
+				}
+			}
+			if errors.Is(err, badger.ErrNoRewrite) || errors.Is(err, badger.ErrRejected) {
+				err = nil
+			}
+			after, sizeErr := g.db.vlogSize()
+			if sizeErr == nil && before > after {
+				result.ReclaimedBytes = before - after
+			}
+			result.Duration = time.Since(startTime)
+			if span := g.db.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(GCRewritesKey.Int(result.Rewrites), GCReclaimedKey.Int64(result.ReclaimedBytes))
+			}
+			if g.db.MetricEnabled() {
+				attrs := metric.WithAttributes(g.db.attrs...)
+				g.runs.Add(ctx, 1, attrs)
+				g.rewrites.Add(ctx, int64(result.Rewrites), attrs)
+				g.reclaimed.Add(ctx, result.ReclaimedBytes, attrs)
+				g.duration.Record(ctx, result.Duration.Milliseconds(), attrs)
+			}
+			return err
+		})
+	return
+}
+
+// RunGC runs the value log GC now until nothing is left to rewrite, paused or not.
+// It does nothing on an in-memory store, which has no value log.
+func (t *DB) RunGC(ctx context.Context) (GCResult, error) {
+	return t.gc.run(ctx, true)
+}
+
+// PauseGC suspends the background GC, e.g. during bulk loads, and waits for the
+// run in progress if any.
+func (t *DB) PauseGC() {
+	t.gc.paused.Store(true)
+	t.gc.mu.Lock()
+	t.gc.mu.Unlock()
+}
+
+func (t *DB) ResumeGC() {
+	t.gc.paused.Store(false)
+}
@@ -0,0 +1,58 @@
+package badger_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+	opts := badger.DefaultOptions(ctx, t.TempDir())
+	opts.ValueThreshold = 1 << 10
+	opts.ValueLogFileSize = 1 << 20
+	// small memtables get the overwritten versions into tables that compactions drop
+	opts.MemTableSize = 16 << 10
+	opts.NumLevelZeroTables = 1
+	// zero options fall back to the defaults instead of running continuously
+	h := badgertest.Open(t, opts, badger.WithGC(badger.BadgerGCOptions{}))
+	time.Sleep(50 * time.Millisecond)
+	h.AssertNoSpan(t, "db.gc.cycle")
+
+	value := bytes.Repeat([]byte{'v'}, 4<<10)
+	for round := range 8 {
+		for i := range 500 {
+			key := []byte{byte(i >> 8), byte(i)}
+			value[0] = byte(round)
+			assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry(key, value)))
+		}
+	}
+	for i := range 250 {
+		assert.NoError(t, h.DB.Delete(ctx, []byte{byte(i >> 8), byte(i)}))
+	}
+	// the discard stats of the value log come from compactions dropping old versions
+	assert.NoError(t, h.DB.DB().Flatten(1))
+	h.DB.PauseGC()
+	result, err := h.DB.RunGC(ctx)
+	assert.NoError(t, err)
+	assert.Positive(t, result.Rewrites)
+	assert.Positive(t, result.ReclaimedBytes)
+	h.AssertSpan(t, "db.gc.cycle", badger.GCRewritesKey.Int(result.Rewrites))
+	h.DB.ResumeGC()
+}
+
+func TestGCInMemory(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t, badger.WithGC(badger.BadgerGCOptions{GCInterval: time.Millisecond}))
+	time.Sleep(20 * time.Millisecond)
+	result, err := h.DB.RunGC(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, badger.GCResult{}, result)
+	h.AssertNoSpan(t, "db.gc.cycle")
+}
@@ -0,0 +1,288 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/ristretto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	LevelKey = attribute.Key("db.badger.level")
+	CacheKey = attribute.Key("db.badger.cache")
+)
+
+// WithInternalMetrics turns on badger's MetricsEnabled and exports its metrics as
+// OpenTelemetry observable instruments tagged with the db attributes.
+//
+// Badger keeps the read/write and compaction counters in process wide expvars, those
+// are reported once for the whole process without the db attributes, through the meter
+// provider of the first store opened with internal metrics.
+func WithInternalMetrics(enabled bool) Option {
+	return func(opt *option) {
+		opt.internalMetrics = enabled
+	}
+}
+
+type internalMetrics struct {
+	lsmSize       metric.Int64ObservableGauge
+	lsmTables     metric.Int64ObservableGauge
+	vlogSize      metric.Int64ObservableGauge
+	memtables     metric.Int64ObservableGauge
+	pendingWrites metric.Int64ObservableGauge
+	cacheHitRatio metric.Float64ObservableGauge
+	cacheHits     metric.Int64ObservableCounter
+	cacheMisses   metric.Int64ObservableCounter
+	registration  metric.Registration
+}
+
+// processMetrics reports the process wide expvars of badger, registered by the first
+// store opened with internal metrics and unregistered when the last one is closed.
+var processMetrics struct {
+	mu                sync.Mutex
+	refs              int
+	compactionTables  metric.Int64ObservableGauge
+	compactionWritten metric.Int64ObservableCounter
+	keysRead          metric.Int64ObservableCounter
+	keysWritten       metric.Int64ObservableCounter
+	registration      metric.Registration
+}
+
+func registerInternalMetrics(t *DB) (*internalMetrics, error) {
+	if err := acquireProcessMetrics(t.meter); err != nil {
+		return nil, err
+	}
+	m, err := registerStoreMetrics(t)
+	if err != nil {
+		releaseProcessMetrics()
+		return nil, err
+	}
+	return m, nil
+}
+
+func registerStoreMetrics(t *DB) (*internalMetrics, error) {
+	m := new(internalMetrics)
+	var err error
+	if m.lsmSize, err = t.meter.Int64ObservableGauge("db.badger.lsm.size",
+		metric.WithDescription("Size of the LSM tree per level"),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, err
+	}
+	if m.lsmTables, err = t.meter.Int64ObservableGauge("db.badger.lsm.tables",
+		metric.WithDescription("Number of tables per LSM level"),
+		metric.WithUnit("{table}"),
+	); err != nil {
+		return nil, err
+	}
+	if m.vlogSize, err = t.meter.Int64ObservableGauge("db.badger.vlog.size",
+		metric.WithDescription("Size of the value log"),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, err
+	}
+	if m.memtables, err = t.meter.Int64ObservableGauge("db.badger.memtable.count",
+		metric.WithDescription("Number of memtables, the mutable one included"),
+		metric.WithUnit("{memtable}"),
+	); err != nil {
+		return nil, err
+	}
+	if m.pendingWrites, err = t.meter.Int64ObservableGauge("db.badger.memtable.pending_writes",
+		metric.WithDescription("Number of writes pending in the memtable"),
+		metric.WithUnit("{write}"),
+	); err != nil {
+		return nil, err
+	}
+	if m.cacheHitRatio, err = t.meter.Float64ObservableGauge("db.badger.cache.hit_ratio",
+		metric.WithDescription("Hit ratio of the block and index caches"),
+		metric.WithUnit("1"),
+	); err != nil {
+		return nil, err
+	}
+	if m.cacheHits, err = t.meter.Int64ObservableCounter("db.badger.cache.hits",
+		metric.WithDescription("Hits of the block and index caches"),
+		metric.WithUnit("{hit}"),
+	); err != nil {
+		return nil, err
+	}
+	if m.cacheMisses, err = t.meter.Int64ObservableCounter("db.badger.cache.misses",
+		metric.WithDescription("Misses of the block and index caches"),
+		metric.WithUnit("{miss}"),
+	); err != nil {
+		return nil, err
+	}
+	m.registration, err = t.meter.RegisterCallback(
+		func(ctx context.Context, o metric.Observer) error {
+			return m.observe(t, o)
+		},
+		m.lsmSize, m.lsmTables, m.vlogSize, m.memtables, m.pendingWrites,
+		m.cacheHitRatio, m.cacheHits, m.cacheMisses,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *internalMetrics) observe(t *DB, o metric.Observer) error {
+	if t.db.IsClosed() {
+		return nil
+	}
+	attrs := metric.WithAttributes(t.attrs...)
+	withAttrs := func(kv ...attribute.KeyValue) metric.MeasurementOption {
+		return metric.WithAttributes(append(append(make([]attribute.KeyValue, 0, len(t.attrs)+len(kv)), t.attrs...), kv...)...)
+	}
+	for _, level := range t.db.Levels() {
+		levelAttrs := withAttrs(LevelKey.Int(level.Level))
+		o.ObserveInt64(m.lsmSize, level.Size, levelAttrs)
+		o.ObserveInt64(m.lsmTables, int64(level.NumTables), levelAttrs)
+	}
+	_, vlog := t.db.Size()
+	o.ObserveInt64(m.vlogSize, vlog, attrs)
+
+	opts := t.db.Opts()
+	if !opts.InMemory {
+		if n, err := memtableCount(opts.Dir); err == nil {
+			o.ObserveInt64(m.memtables, n, attrs)
+		}
+	}
+	o.ObserveInt64(m.pendingWrites, expvarMapInt("badger_write_pending_num_memtable", opts.Dir), attrs)
+
+	for name, metrics := range map[string]*ristretto.Metrics{
+		"block": t.db.BlockCacheMetrics(),
+		"index": t.db.IndexCacheMetrics(),
+	} {
+		if metrics == nil {
+			continue
+		}
+		cacheAttrs := withAttrs(CacheKey.String(name))
+		o.ObserveFloat64(m.cacheHitRatio, metrics.Ratio(), cacheAttrs)
+		o.ObserveInt64(m.cacheHits, int64(metrics.Hits()), cacheAttrs)
+		o.ObserveInt64(m.cacheMisses, int64(metrics.Misses()), cacheAttrs)
+	}
+	return nil
+}
+
+func (m *internalMetrics) unregister() error {
+	if m == nil || m.registration == nil {
+		return nil
+	}
+	err := m.registration.Unregister()
+	m.registration = nil
+	return errors.Join(err, releaseProcessMetrics())
+}
+
+// memtableCount counts the write-ahead log files of the memtables not flushed yet,
+// badger keeps one per memtable.
+func memtableCount(dir string) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".mem") {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func acquireProcessMetrics(meter metric.Meter) error {
+	p := &processMetrics
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refs > 0 {
+		p.refs++
+		return nil
+	}
+	var err error
+	if p.compactionTables, err = meter.Int64ObservableGauge("db.badger.compaction.tables",
+		metric.WithDescription("Number of tables being compacted by the badger stores of the process"),
+		metric.WithUnit("{table}"),
+	); err != nil {
+		return err
+	}
+	if p.compactionWritten, err = meter.Int64ObservableCounter("db.badger.compaction.written",
+		metric.WithDescription("Bytes written by the compactions of the process per target level"),
+		metric.WithUnit("By"),
+	); err != nil {
+		return err
+	}
+	if p.keysRead, err = meter.Int64ObservableCounter("db.badger.keys.read",
+		metric.WithDescription("Number of keys read by users from the badger stores of the process"),
+		metric.WithUnit("{key}"),
+	); err != nil {
+		return err
+	}
+	if p.keysWritten, err = meter.Int64ObservableCounter("db.badger.keys.written",
+		metric.WithDescription("Number of keys written by users to the badger stores of the process"),
+		metric.WithUnit("{key}"),
+	); err != nil {
+		return err
+	}
+	if p.registration, err = meter.RegisterCallback(observeProcessMetrics,
+		p.compactionTables, p.compactionWritten, p.keysRead, p.keysWritten,
+	); err != nil {
+		return err
+	}
+	p.refs = 1
+	return nil
+}
+
+func releaseProcessMetrics() error {
+	p := &processMetrics
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refs--; p.refs > 0 {
+		return nil
+	}
+	err := p.registration.Unregister()
+	p.registration = nil
+	return err
+}
+
+func observeProcessMetrics(ctx context.Context, o metric.Observer) error {
+	p := &processMetrics
+	o.ObserveInt64(p.compactionTables, expvarInt("badger_compaction_current_num_lsm"))
+	if v, ok := expvar.Get("badger_write_bytes_compaction").(*expvar.Map); ok {
+		v.Do(func(kv expvar.KeyValue) {
+			if n, ok := kv.Value.(*expvar.Int); ok {
+				o.ObserveInt64(p.compactionWritten, n.Value(), metric.WithAttributes(LevelKey.String(kv.Key)))
+			}
+		})
+	}
+	o.ObserveInt64(p.keysRead, expvarInt("badger_get_num_user"))
+	o.ObserveInt64(p.keysWritten, expvarInt("badger_put_num_user"))
+	return nil
+}
+
+func expvarInt(name string) int64 {
+	if v, ok := expvar.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func expvarMapInt(name string, key string) int64 {
+	m, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		return 0
+	}
+	switch v := m.Get(key).(type) {
+	case *expvar.Int:
+		return v.Value()
+	case nil:
+		return 0
+	default:
+		n, _ := strconv.ParseInt(v.String(), 10, 64)
+		return n
+	}
+}
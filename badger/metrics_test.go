@@ -0,0 +1,69 @@
+package badger_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// namespaces returns the db.namespace of every data point of m, "" when there is none.
+func namespaces(m metricdata.Metrics) []string {
+	var sets []attribute.Set
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		for _, dp := range data.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Sum[int64]:
+		for _, dp := range data.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	}
+	var ret []string
+	for _, set := range sets {
+		v, _ := set.Value(semconv.DBNamespaceKey)
+		ret = append(ret, v.AsString())
+	}
+	return ret
+}
+
+func TestInternalMetrics(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	h := badgertest.Open(t, badger.DefaultOptions(ctx, dir), badger.WithInternalMetrics(true))
+	other, err := badger.New(ctx, badger.DefaultOptions(ctx, t.TempDir()).WithLogger(nil),
+		badger.WithMetric(true),
+		badger.WithMeterProvider(h.MeterProvider),
+		badger.WithInternalMetrics(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, db := range []*badger.DB{h.DB, other} {
+		assert.NoError(t, db.Update(ctx, dgbadger.NewEntry([]byte("k"), []byte("v"))))
+	}
+
+	// the process wide counters are reported once, without the store namespace
+	for _, name := range []string{"db.badger.keys.written", "db.badger.keys.read", "db.badger.compaction.tables"} {
+		assert.Equal(t, []string{""}, namespaces(h.AssertMetric(t, name)), name)
+	}
+	// the store metrics are reported for each store
+	assert.ElementsMatch(t, []string{dir, other.DB().Opts().Dir}, namespaces(h.AssertMetric(t, "db.badger.vlog.size")))
+	memtables := h.AssertMetric(t, "db.badger.memtable.count")
+	if gauge, ok := memtables.Data.(metricdata.Gauge[int64]); assert.True(t, ok) && assert.Len(t, gauge.DataPoints, 2) {
+		for _, dp := range gauge.DataPoints {
+			assert.Positive(t, dp.Value)
+		}
+	}
+
+	// closing one store keeps the process wide metrics of the other one
+	assert.NoError(t, other.Close(ctx))
+	assert.Equal(t, []string{dir}, namespaces(h.AssertMetric(t, "db.badger.vlog.size")))
+	assert.Equal(t, []string{""}, namespaces(h.AssertMetric(t, "db.badger.keys.written")))
+}
@@ -0,0 +1,96 @@
+package badger
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	KeyCountKey = attribute.Key("db.badger.keys")
+	HitCountKey = attribute.Key("db.badger.hits")
+)
+
+// GetResult is the result of one key of MGet, Err is model.ErrNotFound for a missing key.
+type GetResult struct {
+	Value []byte
+	Err   error
+}
+
+type mgetOption struct {
+	concurrency int
+}
+
+type MGetOption = func(opt *mgetOption)
+
+// WithMGetConcurrency reads the values stored in the value log with up to n goroutines,
+// values small enough to live in the LSM tree are always read inline.
+func WithMGetConcurrency(n int) MGetOption {
+	return func(opt *mgetOption) {
+		opt.concurrency = n
+	}
+}
+
+// MGet reads keys within one read transaction and returns their values in key order.
+func (t *DB) MGet(ctx context.Context, keys [][]byte, options ...MGetOption) ([]GetResult, error) {
+	opt := new(mgetOption)
+	for _, o := range options {
+		o(opt)
+	}
+	results := make([]GetResult, len(keys))
+	if len(keys) == 0 {
+		return results, nil
+	}
+	err := t.withSpan(ctx, "db.mget", "mget", keys[0],
+		func(ctx context.Context) error {
+			var hits int
+			err := t.db.View(func(txn *badger.Txn) error {
+				var (
+					threshold = t.db.Opts().ValueThreshold
+					deferred  []int
+					items     = make([]*badger.Item, len(keys))
+				)
+				for idx, key := range keys {
+					item, err := txn.Get(key)
+					if err != nil {
+						results[idx].Err = mapError(err)
+						continue
+					}
+					hits++
+					if opt.concurrency > 1 && item.ValueSize() >= threshold {
+						items[idx] = item
+						deferred = append(deferred, idx)
+						continue
+					}
+					results[idx].Value, results[idx].Err = item.ValueCopy(nil)
+				}
+				if len(deferred) == 0 {
+					return nil
+				}
+				var (
+					wg  sync.WaitGroup
+					sem = make(chan struct{}, opt.concurrency)
+				)
+				for _, idx := range deferred {
+					wg.Add(1)
+					sem <- struct{}{}
+					go func(idx int) {
+						defer func() {
+							<-sem
+							wg.Done()
+						}()
+						results[idx].Value, results[idx].Err = items[idx].ValueCopy(nil)
+					}(idx)
+				}
+				wg.Wait()
+				return nil
+			})
+			if span := t.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(KeyCountKey.Int(len(keys)), HitCountKey.Int(hits))
+			}
+			return err
+		})
+	return results, err
+}
@@ -0,0 +1,70 @@
+package badger_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	"github.com/XiBao/db/model"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMGet(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	assert.NoError(t, h.DB.Update(ctx,
+		dgbadger.NewEntry([]byte("a"), []byte("1")),
+		dgbadger.NewEntry([]byte("c"), []byte("3"))))
+
+	results, err := h.DB.MGet(ctx, [][]byte{[]byte("c"), []byte("b"), []byte("a"), []byte("c")})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 4) {
+		assert.Equal(t, badger.GetResult{Value: []byte("3")}, results[0])
+		assert.ErrorIs(t, results[1].Err, model.ErrNotFound)
+		assert.Nil(t, results[1].Value)
+		assert.Equal(t, badger.GetResult{Value: []byte("1")}, results[2])
+		assert.Equal(t, badger.GetResult{Value: []byte("3")}, results[3])
+	}
+	h.AssertSpan(t, "db.mget", badger.KeyCountKey.Int(4), badger.HitCountKey.Int(3))
+}
+
+func TestMGetEmpty(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	results, err := h.DB.MGet(ctx, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	h.AssertNoSpan(t, "db.mget")
+}
+
+func TestMGetConcurrency(t *testing.T) {
+	ctx := context.Background()
+	opts := badger.DefaultOptions(ctx, t.TempDir())
+	opts.ValueThreshold = 1 << 10
+	h := badgertest.Open(t, opts)
+
+	var keys [][]byte
+	for i := range 20 {
+		key := []byte(fmt.Sprintf("k%02d", i))
+		// every other value lives in the value log
+		value := bytes.Repeat([]byte{byte('a' + i)}, 16+(i%2)*(2<<10))
+		assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry(key, value)))
+		keys = append(keys, key)
+	}
+	keys = append(keys, []byte("missing"))
+
+	results, err := h.DB.MGet(ctx, keys, badger.WithMGetConcurrency(4))
+	assert.NoError(t, err)
+	if assert.Len(t, results, 21) {
+		for i := range 20 {
+			assert.NoError(t, results[i].Err)
+			assert.Equal(t, 16+(i%2)*(2<<10), len(results[i].Value), i)
+			assert.Equal(t, byte('a'+i), results[i].Value[0], i)
+		}
+		assert.ErrorIs(t, results[20].Err, model.ErrNotFound)
+	}
+}
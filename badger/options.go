@@ -7,11 +7,21 @@ import (
 	"github.com/dgraph-io/badger/v4"
 	"github.com/dgraph-io/badger/v4/options"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type option struct {
 	enableTracing bool
 	enableMetric  bool
+	gc            *BadgerGCOptions
+
+	internalMetrics bool
+	versions        int
+	prefixReport    *prefixReportOptions
+
+	traceProvider trace.TracerProvider
+	meterProvider metric.MeterProvider
 }
 
 type Option = func(opt *option)
@@ -28,6 +38,20 @@ func WithMetric(enabled bool) Option {
 	}
 }
 
+// WithTracerProvider replaces the global tracer provider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(opt *option) {
+		opt.traceProvider = provider
+	}
+}
+
+// WithMeterProvider replaces the global meter provider.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(opt *option) {
+		opt.meterProvider = provider
+	}
+}
+
 func DefaultOptions(ctx context.Context, filePath string) badger.Options {
 	opts := badger.DefaultOptions(filePath).WithLogger(NewBadgerLogger(ctx, 5))
 	opts.NumVersionsToKeep = 1
@@ -71,6 +95,13 @@ func DefaultOptions(ctx context.Context, filePath string) badger.Options {
 	return opts
 }
 
+// InMemoryOptions are DefaultOptions keeping everything in memory, e.g. for tests.
+func InMemoryOptions(ctx context.Context) badger.Options {
+	opts := DefaultOptions(ctx, "")
+	opts.InMemory = true
+	return opts
+}
+
 func LowMemOptions(ctx context.Context, filePath string) badger.Options {
 	opts := DefaultOptions(ctx, filePath)
 	// To allow writes at a faster speed, we create a new memtable as soon as
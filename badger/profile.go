@@ -0,0 +1,227 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/options"
+)
+
+// Workload tells a Profile which side to favor.
+type Workload int
+
+const (
+	Balanced Workload = iota
+	ReadHeavy
+	WriteHeavy
+)
+
+func (w Workload) String() string {
+	switch w {
+	case Balanced:
+		return "balanced"
+	case ReadHeavy:
+		return "read-heavy"
+	case WriteHeavy:
+		return "write-heavy"
+	}
+	return fmt.Sprintf("Workload(%d)", int(w))
+}
+
+var ErrInvalidOptions = errors.New("invalid badger options")
+
+// OptionError reports an invalid profile or badger.Options field, it matches ErrInvalidOptions.
+type OptionError struct {
+	Field string
+	Err   error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("badger option %s: %v", e.Field, e.Err)
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+func (e *OptionError) Is(target error) bool {
+	return target == ErrInvalidOptions
+}
+
+// Profile declares the resources a store may use, Options derives badger.Options from it.
+type Profile struct {
+	// MemoryMB is the memory budget of the memtables and caches.
+	MemoryMB int
+	CPUCores int
+	// DatasetMB is the expected size of the store on disk.
+	DatasetMB int64
+	Workload  Workload
+}
+
+var (
+	LowMemProfile  = Profile{MemoryMB: 512, CPUCores: 2, DatasetMB: 1 << 10}
+	DefaultProfile = Profile{MemoryMB: 4 << 10, CPUCores: 4, DatasetMB: 10 << 10}
+	LargeProfile   = Profile{MemoryMB: 16 << 10, CPUCores: 16, DatasetMB: 200 << 10}
+)
+
+const minProfileMemoryMB = 64
+
+func (p Profile) Validate() error {
+	var errs []error
+	if p.MemoryMB < minProfileMemoryMB {
+		errs = append(errs, &OptionError{Field: "MemoryMB", Err: fmt.Errorf("must be at least %d", minProfileMemoryMB)})
+	}
+	if p.CPUCores < 1 {
+		errs = append(errs, &OptionError{Field: "CPUCores", Err: errors.New("must be at least 1")})
+	}
+	if p.DatasetMB < 0 {
+		errs = append(errs, &OptionError{Field: "DatasetMB", Err: errors.New("must not be negative")})
+	}
+	if p.Workload < Balanced || p.Workload > WriteHeavy {
+		errs = append(errs, &OptionError{Field: "Workload", Err: fmt.Errorf("unknown %s", p.Workload)})
+	}
+	return errors.Join(errs...)
+}
+
+// Options returns DefaultOptions sized for the profile, validated by ValidateOptions.
+//
+// The memory budget is split between the memtables, the block cache and the index
+// cache, read heavy profiles get more cache and write heavy ones more memtables.
+func (p Profile) Options(ctx context.Context, filePath string) (badger.Options, error) {
+	opts := DefaultOptions(ctx, filePath)
+	if err := p.Validate(); err != nil {
+		return opts, err
+	}
+	memory := int64(p.MemoryMB) << 20
+
+	var memtableShare, blockShare, indexShare int64
+	switch p.Workload {
+	case ReadHeavy:
+		memtableShare, blockShare, indexShare = 15, 45, 20
+		opts.NumMemtables = 2
+	case WriteHeavy:
+		memtableShare, blockShare, indexShare = 45, 15, 15
+		opts.NumMemtables = 5
+	default:
+		memtableShare, blockShare, indexShare = 25, 30, 20
+		opts.NumMemtables = 3
+	}
+	opts.MemTableSize = min(max(memory*memtableShare/100/int64(opts.NumMemtables), 4<<20), 256<<20)
+	opts.ValueThreshold = min(opts.ValueThreshold, 15*opts.MemTableSize/100)
+	opts.BlockCacheSize = memory * blockShare / 100
+	opts.IndexCacheSize = memory * indexShare / 100
+
+	switch {
+	case p.Workload == WriteHeavy:
+		opts.NumLevelZeroTables = 10
+		opts.NumLevelZeroTablesStall = 20
+	case p.MemoryMB < 1<<10:
+		opts.NumLevelZeroTables = 1
+		opts.NumLevelZeroTablesStall = 2
+	default:
+		opts.NumLevelZeroTables = 5
+		opts.NumLevelZeroTablesStall = 15
+	}
+
+	opts.NumCompactors = max(2, min(p.CPUCores/2, 8))
+	opts.NumGoroutines = max(1, p.CPUCores)
+	if p.CPUCores < 2 {
+		opts.Compression = options.None
+	}
+
+	switch {
+	case p.DatasetMB < 1<<10:
+		opts.ValueLogFileSize = 64 << 20
+		opts.BaseTableSize = 2 << 20
+	case p.DatasetMB < 100<<10:
+		opts.ValueLogFileSize = 256 << 20
+		opts.BaseTableSize = 8 << 20
+	default:
+		opts.ValueLogFileSize = 1<<30 - 1
+		opts.BaseTableSize = 16 << 20
+	}
+	opts.BaseLevelSize = opts.BaseTableSize * 5
+	return opts, ValidateOptions(opts)
+}
+
+// ValidateOptions reports the inconsistent fields of opts, including the ones badger
+// itself would reject or panic on when opening the store.
+func ValidateOptions(opts badger.Options) error {
+	var errs []error
+	invalid := func(field string, format string, args ...any) {
+		errs = append(errs, &OptionError{Field: field, Err: fmt.Errorf(format, args...)})
+	}
+	if opts.NumLevelZeroTablesStall <= opts.NumLevelZeroTables {
+		invalid("NumLevelZeroTablesStall", "%d must be greater than NumLevelZeroTables %d",
+			opts.NumLevelZeroTablesStall, opts.NumLevelZeroTables)
+	}
+	if opts.NumCompactors == 1 {
+		invalid("NumCompactors", "must be 0 or at least 2")
+	}
+	if opts.NumMemtables < 1 {
+		invalid("NumMemtables", "must be at least 1")
+	}
+	if opts.MemTableSize <= 0 {
+		invalid("MemTableSize", "must be positive")
+	}
+	if opts.ValueLogFileSize < 1<<20 || opts.ValueLogFileSize >= 2<<30 {
+		invalid("ValueLogFileSize", "%d must be in [1MB, 2GB)", opts.ValueLogFileSize)
+	}
+	if maxBatchSize := 15 * opts.MemTableSize / 100; opts.ValueThreshold > min(1<<20, maxBatchSize) {
+		invalid("ValueThreshold", "%d must not exceed 1MB nor 15%% of MemTableSize", opts.ValueThreshold)
+	}
+	if opts.BaseLevelSize < opts.BaseTableSize {
+		invalid("BaseLevelSize", "%d must not be smaller than BaseTableSize %d", opts.BaseLevelSize, opts.BaseTableSize)
+	}
+	if (opts.Compression != options.None || len(opts.EncryptionKey) > 0) && opts.BlockCacheSize <= 0 {
+		invalid("BlockCacheSize", "must be set when compression or encryption is enabled")
+	}
+	if len(opts.EncryptionKey) > 0 {
+		if err := ValidateEncryptionKey(opts.EncryptionKey); err != nil {
+			invalid("EncryptionKey", "%w", err)
+		}
+		if opts.IndexCacheSize <= 0 {
+			invalid("IndexCacheSize", "must be set when encryption is enabled")
+		}
+	}
+	if opts.InMemory && (opts.Dir != "" || opts.ValueDir != "") {
+		invalid("InMemory", "Dir and ValueDir must be empty")
+	}
+	return errors.Join(errs...)
+}
+
+// PrintOptions writes the fields of opts sorted by name, one "name = value" per line,
+// with the encryption key redacted.
+func PrintOptions(w io.Writer, opts badger.Options) error {
+	v := reflect.ValueOf(opts)
+	typ := v.Type()
+	lines := make([]string, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		var value any
+		switch field.Name {
+		case "EncryptionKey":
+			value = fmt.Sprintf("<%d bytes redacted>", len(opts.EncryptionKey))
+		case "Logger":
+			value = fmt.Sprintf("%T", opts.Logger)
+		default:
+			value = v.Field(i).Interface()
+		}
+		lines = append(lines, fmt.Sprintf("%s = %v\n", field.Name, value))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package badger_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/XiBao/db/badger"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/options"
+	"github.com/stretchr/testify/assert"
+)
+
+// optionFields returns the sorted fields of the OptionErrors joined in err.
+func optionFields(err error) []string {
+	var fields []string
+	var walk func(err error)
+	walk = func(err error) {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range joined.Unwrap() {
+				walk(err)
+			}
+			return
+		}
+		var optErr *badger.OptionError
+		if errors.As(err, &optErr) {
+			fields = append(fields, optErr.Field)
+		}
+	}
+	walk(err)
+	sort.Strings(fields)
+	return fields
+}
+
+func TestProfileOptions(t *testing.T) {
+	const mb = int64(1 << 20)
+	for _, tt := range []struct {
+		name    string
+		profile badger.Profile
+		want    dgbadger.Options
+	}{
+		{
+			name:    "low mem",
+			profile: badger.LowMemProfile,
+			want: dgbadger.Options{
+				NumMemtables: 3, MemTableSize: 512 * mb * 25 / 100 / 3,
+				BlockCacheSize: 512 * mb * 30 / 100, IndexCacheSize: 512 * mb * 20 / 100,
+				NumLevelZeroTables: 1, NumLevelZeroTablesStall: 2,
+				NumCompactors: 2, NumGoroutines: 2, Compression: options.Snappy,
+				ValueLogFileSize: 256 << 20, BaseTableSize: 8 << 20, BaseLevelSize: 40 << 20,
+			},
+		},
+		{
+			name:    "default",
+			profile: badger.DefaultProfile,
+			want: dgbadger.Options{
+				NumMemtables: 3, MemTableSize: 256 * mb,
+				BlockCacheSize: 4096 * mb * 30 / 100, IndexCacheSize: 4096 * mb * 20 / 100,
+				NumLevelZeroTables: 5, NumLevelZeroTablesStall: 15,
+				NumCompactors: 2, NumGoroutines: 4, Compression: options.Snappy,
+				ValueLogFileSize: 256 << 20, BaseTableSize: 8 << 20, BaseLevelSize: 40 << 20,
+			},
+		},
+		{
+			name:    "large",
+			profile: badger.LargeProfile,
+			want: dgbadger.Options{
+				NumMemtables: 3, MemTableSize: 256 * mb,
+				BlockCacheSize: 16384 * mb * 30 / 100, IndexCacheSize: 16384 * mb * 20 / 100,
+				NumLevelZeroTables: 5, NumLevelZeroTablesStall: 15,
+				NumCompactors: 8, NumGoroutines: 16, Compression: options.Snappy,
+				ValueLogFileSize: 1<<30 - 1, BaseTableSize: 16 << 20, BaseLevelSize: 80 << 20,
+			},
+		},
+		{
+			name:    "read heavy single core",
+			profile: badger.Profile{MemoryMB: 1024, CPUCores: 1, DatasetMB: 100, Workload: badger.ReadHeavy},
+			want: dgbadger.Options{
+				NumMemtables: 2, MemTableSize: 1024 * mb * 15 / 100 / 2,
+				BlockCacheSize: 1024 * mb * 45 / 100, IndexCacheSize: 1024 * mb * 20 / 100,
+				NumLevelZeroTables: 5, NumLevelZeroTablesStall: 15,
+				NumCompactors: 2, NumGoroutines: 1, Compression: options.None,
+				ValueLogFileSize: 64 << 20, BaseTableSize: 2 << 20, BaseLevelSize: 10 << 20,
+			},
+		},
+		{
+			name:    "write heavy",
+			profile: badger.Profile{MemoryMB: 256, CPUCores: 8, Workload: badger.WriteHeavy},
+			want: dgbadger.Options{
+				NumMemtables: 5, MemTableSize: 256 * mb * 45 / 100 / 5,
+				BlockCacheSize: 256 * mb * 15 / 100, IndexCacheSize: 256 * mb * 15 / 100,
+				NumLevelZeroTables: 10, NumLevelZeroTablesStall: 20,
+				NumCompactors: 4, NumGoroutines: 8, Compression: options.Snappy,
+				ValueLogFileSize: 64 << 20, BaseTableSize: 2 << 20, BaseLevelSize: 10 << 20,
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.profile.Options(context.Background(), t.TempDir())
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want.NumMemtables, opts.NumMemtables, "NumMemtables")
+			assert.Equal(t, tt.want.MemTableSize, opts.MemTableSize, "MemTableSize")
+			assert.Equal(t, tt.want.BlockCacheSize, opts.BlockCacheSize, "BlockCacheSize")
+			assert.Equal(t, tt.want.IndexCacheSize, opts.IndexCacheSize, "IndexCacheSize")
+			assert.Equal(t, tt.want.NumLevelZeroTables, opts.NumLevelZeroTables, "NumLevelZeroTables")
+			assert.Equal(t, tt.want.NumLevelZeroTablesStall, opts.NumLevelZeroTablesStall, "NumLevelZeroTablesStall")
+			assert.Equal(t, tt.want.NumCompactors, opts.NumCompactors, "NumCompactors")
+			assert.Equal(t, tt.want.NumGoroutines, opts.NumGoroutines, "NumGoroutines")
+			assert.Equal(t, tt.want.Compression, opts.Compression, "Compression")
+			assert.Equal(t, tt.want.ValueLogFileSize, opts.ValueLogFileSize, "ValueLogFileSize")
+			assert.Equal(t, tt.want.BaseTableSize, opts.BaseTableSize, "BaseTableSize")
+			assert.Equal(t, tt.want.BaseLevelSize, opts.BaseLevelSize, "BaseLevelSize")
+			assert.LessOrEqual(t, opts.ValueThreshold, 15*opts.MemTableSize/100)
+		})
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		profile badger.Profile
+		fields  []string
+	}{
+		{"memory", badger.Profile{MemoryMB: 32, CPUCores: 1}, []string{"MemoryMB"}},
+		{"cpu", badger.Profile{MemoryMB: 64}, []string{"CPUCores"}},
+		{"dataset", badger.Profile{MemoryMB: 64, CPUCores: 1, DatasetMB: -1}, []string{"DatasetMB"}},
+		{"workload", badger.Profile{MemoryMB: 64, CPUCores: 1, Workload: badger.Workload(9)}, []string{"Workload"}},
+		{"all", badger.Profile{DatasetMB: -1, Workload: -1}, []string{"CPUCores", "DatasetMB", "MemoryMB", "Workload"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.profile.Options(context.Background(), t.TempDir())
+			assert.ErrorIs(t, err, badger.ErrInvalidOptions)
+			assert.Equal(t, tt.fields, optionFields(err))
+		})
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	valid := func() dgbadger.Options {
+		opts, err := badger.LowMemProfile.Options(context.Background(), "/tmp/db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return opts
+	}
+	assert.NoError(t, badger.ValidateOptions(valid()))
+	for _, tt := range []struct {
+		name   string
+		update func(opts *dgbadger.Options)
+		fields []string
+	}{
+		{"level zero stall", func(opts *dgbadger.Options) { opts.NumLevelZeroTablesStall = opts.NumLevelZeroTables }, []string{"NumLevelZeroTablesStall"}},
+		{"one compactor", func(opts *dgbadger.Options) { opts.NumCompactors = 1 }, []string{"NumCompactors"}},
+		{"no memtables", func(opts *dgbadger.Options) { opts.NumMemtables = 0 }, []string{"NumMemtables"}},
+		{"memtable size", func(opts *dgbadger.Options) { opts.MemTableSize = 0 }, []string{"MemTableSize", "ValueThreshold"}},
+		{"small value log", func(opts *dgbadger.Options) { opts.ValueLogFileSize = 1 << 10 }, []string{"ValueLogFileSize"}},
+		{"large value log", func(opts *dgbadger.Options) { opts.ValueLogFileSize = 2 << 30 }, []string{"ValueLogFileSize"}},
+		{"value threshold", func(opts *dgbadger.Options) { opts.ValueThreshold = 2 << 20 }, []string{"ValueThreshold"}},
+		{"base level", func(opts *dgbadger.Options) { opts.BaseLevelSize = opts.BaseTableSize - 1 }, []string{"BaseLevelSize"}},
+		{"compression without cache", func(opts *dgbadger.Options) { opts.BlockCacheSize = 0 }, []string{"BlockCacheSize"}},
+		{"encryption key", func(opts *dgbadger.Options) { opts.EncryptionKey = []byte("short") }, []string{"EncryptionKey"}},
+		{"encryption without caches", func(opts *dgbadger.Options) {
+			opts.EncryptionKey = bytes.Repeat([]byte{1}, 16)
+			opts.Compression = options.None
+			opts.BlockCacheSize = 0
+			opts.IndexCacheSize = 0
+		}, []string{"BlockCacheSize", "IndexCacheSize"}},
+		{"in memory with dir", func(opts *dgbadger.Options) { opts.InMemory = true }, []string{"InMemory"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := valid()
+			tt.update(&opts)
+			err := badger.ValidateOptions(opts)
+			assert.ErrorIs(t, err, badger.ErrInvalidOptions)
+			assert.Equal(t, tt.fields, optionFields(err))
+		})
+	}
+}
+
+func TestPrintOptions(t *testing.T) {
+	opts := dgbadger.DefaultOptions("/tmp/db").WithEncryptionKey([]byte("0123456789abcdef"))
+	var out strings.Builder
+	assert.NoError(t, badger.PrintOptions(&out, opts))
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.True(t, sort.StringsAreSorted(lines))
+	assert.Contains(t, lines, "Dir = /tmp/db")
+	assert.Contains(t, lines, "EncryptionKey = <16 bytes redacted>")
+	assert.Contains(t, lines, "Logger = *badger.defaultLog")
+	assert.NotContains(t, out.String(), "0123456789abcdef")
+	for _, line := range lines {
+		assert.NotRegexp(t, "^[a-z]", line, "unexported field")
+	}
+}
@@ -0,0 +1,204 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"iter"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	KeysVisitedKey = attribute.Key("db.badger.keys_visited")
+	BytesReadKey   = attribute.Key("db.badger.bytes_read")
+)
+
+// ErrStopScan can be returned by a scan callback to end the scan without error.
+var ErrStopScan = errors.New("stop scan")
+
+// ScanOptions selects the keys visited by Scan, the zero value scans the whole db.
+// Start is inclusive and End exclusive in both directions.
+type ScanOptions struct {
+	Prefix      []byte
+	Start       []byte
+	End         []byte
+	Reverse     bool
+	Limit       int
+	KeysOnly    bool
+	AllVersions bool
+}
+
+// KV is an item visited by a scan, Key and Value are only valid until the callback returns.
+type KV struct {
+	Key       []byte
+	Value     []byte
+	Version   uint64
+	ExpiresAt uint64
+	Deleted   bool
+}
+
+type scanStats struct {
+	keys  int
+	bytes int
+}
+
+// Scan calls fn for every key selected by opts within one read transaction.
+func (t *DB) Scan(ctx context.Context, opts *ScanOptions, fn func(kv *KV) error) error {
+	if opts == nil {
+		opts = new(ScanOptions)
+	}
+	return t.withSpan(ctx, "db.scan", "scan", opts.spanKey(),
+		func(ctx context.Context) error {
+			return t.db.View(func(txn *badger.Txn) error {
+				stats, err := scanTxn(txn, opts, fn)
+				t.recordScan(ctx, stats)
+				return err
+			})
+		})
+}
+
+// ScanSeq is Scan as an iterator, an error ends the sequence as its last element.
+func (t *DB) ScanSeq(ctx context.Context, opts *ScanOptions) iter.Seq2[*KV, error] {
+	return func(yield func(*KV, error) bool) {
+		if err := t.Scan(ctx, opts, func(kv *KV) error {
+			if !yield(kv, nil) {
+				return ErrStopScan
+			}
+			return nil
+		}); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+func (t *DB) recordScan(ctx context.Context, stats scanStats) {
+	if span := t.span(ctx); span != nil && span.IsRecording() {
+		span.SetAttributes(KeysVisitedKey.Int(stats.keys), BytesReadKey.Int(stats.bytes))
+	}
+}
+
+func (opts *ScanOptions) spanKey() []byte {
+	switch {
+	case opts.Prefix != nil:
+		return opts.Prefix
+	case opts.Reverse && opts.End != nil:
+		return opts.End
+	case opts.Start != nil:
+		return opts.Start
+	}
+	return []byte{}
+}
+
+func (opts *ScanOptions) iteratorOptions() badger.IteratorOptions {
+	iterOpts := badger.DefaultIteratorOptions
+	// a reverse scan seeks to the first key after the prefix, which the iterator
+	// would reject as invalid, the loop stops at the prefix instead
+	if !opts.Reverse {
+		iterOpts.Prefix = opts.Prefix
+	}
+	iterOpts.Reverse = opts.Reverse
+	iterOpts.AllVersions = opts.AllVersions
+	iterOpts.PrefetchValues = !opts.KeysOnly
+	if opts.Limit > 0 && opts.Limit < iterOpts.PrefetchSize {
+		iterOpts.PrefetchSize = opts.Limit
+	}
+	return iterOpts
+}
+
+// upperBound returns the exclusive upper bound of the scan, End clamped to the keys
+// with Prefix, nil when the scan runs up to the last key.
+func (opts *ScanOptions) upperBound() []byte {
+	end := opts.End
+	if next := prefixEnd(opts.Prefix); next != nil && (end == nil || bytes.Compare(next, end) < 0) {
+		end = next
+	}
+	return end
+}
+
+// prefixEnd returns the first key sorting after every key with prefix, nil when
+// there is none, for an empty prefix or one of 0xff bytes only.
+func prefixEnd(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			end := append([]byte(nil), prefix[:i+1]...)
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}
+
+func (opts *ScanOptions) seekKey() []byte {
+	if opts.Reverse {
+		// a reverse seek lands on the last key <= the upper bound
+		return opts.upperBound()
+	}
+	if opts.Start != nil && bytes.Compare(opts.Start, opts.Prefix) > 0 {
+		return opts.Start
+	}
+	return opts.Prefix
+}
+
+// scanTxn runs the scan described by opts inside txn.
+func scanTxn(txn *badger.Txn, opts *ScanOptions, fn func(kv *KV) error) (stats scanStats, err error) {
+	it := txn.NewIterator(opts.iteratorOptions())
+	defer it.Close()
+	var (
+		count int
+		kv    KV
+		end   = opts.upperBound()
+	)
+	if seek := opts.seekKey(); seek != nil {
+		it.Seek(seek)
+	} else {
+		it.Rewind()
+	}
+	for ; it.Valid(); it.Next() {
+		item := it.Item()
+		key := item.Key()
+		if end != nil && bytes.Compare(key, end) >= 0 {
+			if opts.Reverse {
+				// the versions of the upper bound itself
+				continue
+			}
+			break
+		}
+		if opts.Reverse {
+			if opts.Start != nil && bytes.Compare(key, opts.Start) < 0 {
+				break
+			}
+			if !bytes.HasPrefix(key, opts.Prefix) {
+				break
+			}
+		}
+		stats.keys++
+		stats.bytes += len(key)
+		kv = KV{
+			Key:       key,
+			Version:   item.Version(),
+			ExpiresAt: item.ExpiresAt(),
+			Deleted:   item.IsDeletedOrExpired(),
+		}
+		if !opts.KeysOnly && !kv.Deleted {
+			if err = item.Value(func(val []byte) error {
+				kv.Value = val
+				stats.bytes += len(val)
+				return fn(&kv)
+			}); err != nil {
+				break
+			}
+		} else if err = fn(&kv); err != nil {
+			break
+		}
+		count++
+		if opts.Limit > 0 && count >= opts.Limit {
+			break
+		}
+	}
+	if errors.Is(err, ErrStopScan) {
+		err = nil
+	}
+	return stats, err
+}
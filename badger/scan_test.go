@@ -0,0 +1,115 @@
+package badger_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// longSuffix has more leading 0xff bytes than any fixed seek padding.
+var longSuffix = "a" + strings.Repeat("\xff", 12) + "z"
+
+func scanKeys(t *testing.T, db *badger.DB, opts *badger.ScanOptions) []string {
+	keys := []string{}
+	assert.NoError(t, db.Scan(context.Background(), opts, func(kv *badger.KV) error {
+		keys = append(keys, string(kv.Key))
+		return nil
+	}))
+	return keys
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	var entries []*dgbadger.Entry
+	for _, key := range []string{"a1", "a2", longSuffix, "b", "b1", "c1"} {
+		entries = append(entries, dgbadger.NewEntry([]byte(key), []byte("v-"+key)))
+	}
+	assert.NoError(t, h.DB.Update(ctx, entries...))
+
+	for _, tc := range []struct {
+		name string
+		opts *badger.ScanOptions
+		want []string
+	}{
+		{"all", nil, []string{"a1", "a2", longSuffix, "b", "b1", "c1"}},
+		{"all reverse", &badger.ScanOptions{Reverse: true}, []string{"c1", "b1", "b", longSuffix, "a2", "a1"}},
+		{"prefix", &badger.ScanOptions{Prefix: []byte("a")}, []string{"a1", "a2", longSuffix}},
+		{"prefix reverse", &badger.ScanOptions{Prefix: []byte("a"), Reverse: true}, []string{longSuffix, "a2", "a1"}},
+		{"prefix followed by its successor reverse", &badger.ScanOptions{Prefix: []byte("b"), Reverse: true}, []string{"b1", "b"}},
+		{"prefix end past prefix", &badger.ScanOptions{Prefix: []byte("a"), End: []byte("z")}, []string{"a1", "a2", longSuffix}},
+		{"prefix end past prefix reverse", &badger.ScanOptions{Prefix: []byte("a"), End: []byte("z"), Reverse: true}, []string{longSuffix, "a2", "a1"}},
+		{"prefix end inside prefix reverse", &badger.ScanOptions{Prefix: []byte("a"), End: []byte("a2"), Reverse: true}, []string{"a1"}},
+		{"prefix start", &badger.ScanOptions{Prefix: []byte("a"), Start: []byte("a2")}, []string{"a2", longSuffix}},
+		{"prefix start reverse", &badger.ScanOptions{Prefix: []byte("a"), Start: []byte("a2"), Reverse: true}, []string{longSuffix, "a2"}},
+		{"start end", &badger.ScanOptions{Start: []byte("a2"), End: []byte("b1")}, []string{"a2", longSuffix, "b"}},
+		{"start end reverse", &badger.ScanOptions{Start: []byte("a2"), End: []byte("b1"), Reverse: true}, []string{"b", longSuffix, "a2"}},
+		{"end reverse", &badger.ScanOptions{End: []byte("b"), Reverse: true}, []string{longSuffix, "a2", "a1"}},
+		{"limit", &badger.ScanOptions{Limit: 2}, []string{"a1", "a2"}},
+		{"limit reverse", &badger.ScanOptions{Limit: 2, Reverse: true}, []string{"c1", "b1"}},
+		{"prefix limit reverse", &badger.ScanOptions{Prefix: []byte("a"), Limit: 2, Reverse: true}, []string{longSuffix, "a2"}},
+		{"missing prefix", &badger.ScanOptions{Prefix: []byte("d")}, []string{}},
+		{"missing prefix reverse", &badger.ScanOptions{Prefix: []byte("d"), Reverse: true}, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, scanKeys(t, h.DB, tc.opts))
+		})
+	}
+}
+
+func TestScanValues(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("k"), []byte("v"))))
+
+	var values, keysOnly []string
+	assert.NoError(t, h.DB.Scan(ctx, nil, func(kv *badger.KV) error {
+		values = append(values, string(kv.Value))
+		return nil
+	}))
+	assert.NoError(t, h.DB.Scan(ctx, &badger.ScanOptions{KeysOnly: true}, func(kv *badger.KV) error {
+		keysOnly = append(keysOnly, string(kv.Value))
+		return nil
+	}))
+	assert.Equal(t, []string{"v"}, values)
+	assert.Equal(t, []string{""}, keysOnly)
+
+	boom := errors.New("boom")
+	assert.ErrorIs(t, h.DB.Scan(ctx, nil, func(kv *badger.KV) error { return boom }), boom)
+	assert.NoError(t, h.DB.Scan(ctx, nil, func(kv *badger.KV) error { return badger.ErrStopScan }))
+	h.AssertSpan(t, "db.scan", badger.KeysVisitedKey.Int(1))
+}
+
+func TestScanSeq(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	assert.NoError(t, h.DB.Update(ctx,
+		dgbadger.NewEntry([]byte("a1"), []byte("1")),
+		dgbadger.NewEntry([]byte("a2"), []byte("2")),
+		dgbadger.NewEntry([]byte("a3"), []byte("3")),
+		dgbadger.NewEntry([]byte("b1"), []byte("4"))))
+
+	var keys []string
+	for kv, err := range h.DB.ScanSeq(ctx, &badger.ScanOptions{Prefix: []byte("a"), Reverse: true}) {
+		assert.NoError(t, err)
+		keys = append(keys, string(kv.Key))
+	}
+	assert.Equal(t, []string{"a3", "a2", "a1"}, keys)
+
+	// breaking out of the loop ends the scan without error
+	keys = nil
+	for kv, err := range h.DB.ScanSeq(ctx, nil) {
+		assert.NoError(t, err)
+		keys = append(keys, string(kv.Key))
+		if len(keys) == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"a1", "a2"}, keys)
+}
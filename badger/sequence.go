@@ -0,0 +1,103 @@
+package badger
+
+import (
+	"context"
+	"errors"
+
+	"github.com/XiBao/db/model"
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	SequenceBandwidthKey = attribute.Key("db.badger.sequence.bandwidth")
+	SequenceCountKey     = attribute.Key("db.badger.sequence.count")
+)
+
+var _ model.Sequence = (*Sequence)(nil)
+
+// Sequence is a traced badger.Sequence, released by Close or DB.Close.
+type Sequence struct {
+	db  *DB
+	key []byte
+	seq *badger.Sequence
+}
+
+// GetSequence returns the sequence stored at key, leasing bandwidth ids at a time. Only
+// one sequence of a key should be open at once, badger releases by writing back its next id.
+func (t *DB) GetSequence(ctx context.Context, key []byte, bandwidth uint64) (s *Sequence, err error) {
+	err = t.withSpan(ctx, "db.sequence.get", "sequence", key,
+		func(ctx context.Context) error {
+			if span := t.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(SequenceBandwidthKey.Int64(int64(bandwidth)))
+			}
+			seq, err := t.db.GetSequence(key, bandwidth)
+			if err != nil {
+				return mapError(err)
+			}
+			s = &Sequence{db: t, key: key, seq: seq}
+			t.seqMu.Lock()
+			t.sequences[s] = struct{}{}
+			t.seqMu.Unlock()
+			return nil
+		})
+	return
+}
+
+func (s *Sequence) Next(ctx context.Context) (id uint64, err error) {
+	err = s.db.withSpan(ctx, "db.sequence.next", "sequence", s.key,
+		func(ctx context.Context) error {
+			id, err = s.seq.Next()
+			return err
+		})
+	return
+}
+
+func (s *Sequence) NextN(ctx context.Context, n int) (ids []uint64, err error) {
+	err = s.db.withSpan(ctx, "db.sequence.next", "sequence", s.key,
+		func(ctx context.Context) error {
+			if span := s.db.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(SequenceCountKey.Int(n))
+			}
+			ids = make([]uint64, 0, max(n, 0))
+			for range n {
+				id, err := s.seq.Next()
+				if err != nil {
+					ids = nil
+					return err
+				}
+				ids = append(ids, id)
+			}
+			return nil
+		})
+	return
+}
+
+// Close releases the sequence, the next sequence of the key starts from its next id.
+func (s *Sequence) Close(ctx context.Context) error {
+	s.db.seqMu.Lock()
+	_, ok := s.db.sequences[s]
+	delete(s.db.sequences, s)
+	s.db.seqMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return s.db.withSpan(ctx, "db.sequence.release", "sequence", s.key,
+		func(ctx context.Context) error {
+			return s.seq.Release()
+		})
+}
+
+func (t *DB) releaseSequences() error {
+	t.seqMu.Lock()
+	sequences := t.sequences
+	t.sequences = make(map[*Sequence]struct{})
+	t.seqMu.Unlock()
+	var errs []error
+	for s := range sequences {
+		if err := s.seq.Release(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
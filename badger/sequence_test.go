@@ -0,0 +1,47 @@
+package badger_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/XiBao/db/badger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequenceRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	open := func() *badger.DB {
+		db, err := badger.New(ctx, badger.DefaultOptions(ctx, dir).WithLogger(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+
+	db := open()
+	seq, err := db.GetSequence(ctx, []byte("ids"), 10)
+	assert.NoError(t, err)
+	ids, err := seq.NextN(ctx, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{0, 1, 2}, ids)
+	assert.NoError(t, seq.Close(ctx))
+	assert.NoError(t, db.Close(ctx))
+
+	// the released sequence continues where it stopped, DB.Close releases the open ones
+	db = open()
+	seq, err = db.GetSequence(ctx, []byte("ids"), 10)
+	assert.NoError(t, err)
+	id, err := seq.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), id)
+	assert.NoError(t, db.Close(ctx))
+
+	db = open()
+	defer db.Close(ctx)
+	seq, err = db.GetSequence(ctx, []byte("ids"), 10)
+	assert.NoError(t, err)
+	id, err = seq.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), id)
+}
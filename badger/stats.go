@@ -0,0 +1,396 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	PrefixKey       = attribute.Key("db.badger.prefix")
+	StatsSampledKey = attribute.Key("db.badger.stats.sampled")
+)
+
+const (
+	// DefaultStatsSamples is the number of keys sampled by WithPrefixHistogram by default.
+	DefaultStatsSamples = 10000
+	// DefaultPrefixReportInterval is used by WithPrefixReport when interval is not positive.
+	DefaultPrefixReportInterval = 5 * time.Minute
+	// MaxReportedPrefixes caps the prefixes exported by WithPrefixReport, the smaller
+	// ones are summed under OtherPrefix.
+	MaxReportedPrefixes = 50
+	OtherPrefix         = "other"
+)
+
+// Stats describes the size of the store, see DB.Stats.
+type Stats struct {
+	LSMSize  int64
+	VLogSize int64
+	Levels   []LevelStats
+	// EstimatedKeys sums the keys of the LSM tables, it counts old versions, deletes
+	// and expired keys not compacted yet, and not the keys still in the memtables.
+	EstimatedKeys uint64
+	// Prefixes is the prefix histogram, largest first, set by WithPrefixHistogram.
+	Prefixes []PrefixStats
+	// Sampled is the number of keys the histogram was computed from, Exact tells whether
+	// they were all the keys of the store.
+	Sampled int
+	Exact   bool
+}
+
+type LevelStats struct {
+	Level      int
+	Tables     int
+	Size       int64
+	TargetSize int64
+}
+
+// PrefixStats is the estimated share of a prefix, Bytes counts keys and values.
+type PrefixStats struct {
+	Prefix string
+	Keys   int64
+	Bytes  int64
+}
+
+// PrefixFunc returns the prefix key is counted under by the prefix histogram.
+type PrefixFunc func(key []byte) []byte
+
+// PrefixUntil counts keys under their bytes up to and including the first sep, e.g. the
+// "name:" of collections, and keys without sep under the empty prefix.
+func PrefixUntil(sep byte) PrefixFunc {
+	return func(key []byte) []byte {
+		if i := bytes.IndexByte(key, sep); i >= 0 {
+			return key[:i+1]
+		}
+		return nil
+	}
+}
+
+type statsOption struct {
+	prefix  PrefixFunc
+	samples int
+}
+
+type StatsOption = func(opt *statsOption)
+
+// WithPrefixHistogram adds the prefix histogram to Stats, computed from about samples keys
+// read from the start of every LSM table, DefaultStatsSamples when samples is not positive.
+func WithPrefixHistogram(fn PrefixFunc, samples int) StatsOption {
+	return func(opt *statsOption) {
+		opt.prefix = fn
+		opt.samples = samples
+	}
+}
+
+// Stats returns the sizes of the LSM tree and the value log, the tables per level and
+// the estimated number of keys.
+func (t *DB) Stats(ctx context.Context, opts ...StatsOption) (stats *Stats, err error) {
+	opt := statsOption{samples: DefaultStatsSamples}
+	for _, o := range opts {
+		o(&opt)
+	}
+	err = t.withSpan(ctx, "db.stats", "stats", []byte{},
+		func(ctx context.Context) error {
+			stats, err = t.stats(opt)
+			if err != nil {
+				return err
+			}
+			if span := t.span(ctx); opt.prefix != nil && span != nil && span.IsRecording() {
+				span.SetAttributes(StatsSampledKey.Int(stats.Sampled))
+			}
+			return nil
+		})
+	return
+}
+
+// stats is Stats without span, for the prefix report running in the background.
+func (t *DB) stats(opt statsOption) (*Stats, error) {
+	if opt.samples <= 0 {
+		opt.samples = DefaultStatsSamples
+	}
+	stats := new(Stats)
+	for _, level := range t.db.Levels() {
+		stats.Levels = append(stats.Levels, LevelStats{
+			Level:      level.Level,
+			Tables:     level.NumTables,
+			Size:       level.Size,
+			TargetSize: level.TargetSize,
+		})
+		stats.LSMSize += level.Size
+	}
+	tables := t.db.Tables()
+	for _, table := range tables {
+		stats.EstimatedKeys += uint64(table.KeyCount)
+	}
+	vlog, err := t.vlogSize()
+	if err != nil {
+		return nil, err
+	}
+	stats.VLogSize = vlog
+	if opt.prefix == nil {
+		return stats, nil
+	}
+	if err := t.prefixHistogram(stats, tables, opt); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// vlogSize sums the value log files, badger.DB.Size only does with MetricsEnabled.
+func (t *DB) vlogSize() (int64, error) {
+	opts := t.db.Opts()
+	if opts.InMemory {
+		return 0, nil
+	}
+	var size int64
+	err := filepath.WalkDir(opts.ValueDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != opts.ValueDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".vlog") {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// prefixHistogram reads up to the same number of keys from the smallest key of every
+// table, until the smallest key of the next one, and scales the counts to the store.
+// The keys still in the memtables are only sampled where they fall in those ranges.
+func (t *DB) prefixHistogram(stats *Stats, tables []badger.TableInfo, opt statsOption) error {
+	starts := [][]byte{nil}
+	for _, table := range tables {
+		if len(table.Left) >= 8 {
+			// table keys end with their version
+			starts = append(starts, table.Left[:len(table.Left)-8])
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		return bytes.Compare(starts[i], starts[j]) < 0
+	})
+	starts = compactKeys(starts)
+	perStart := max(opt.samples/len(starts), 1)
+	if len(tables) == 0 {
+		// everything is in the memtables, small enough to be read entirely
+		perStart = math.MaxInt
+	}
+
+	type bucket struct {
+		keys  int64
+		bytes int64
+	}
+	buckets := make(map[string]*bucket)
+	var sampledBytes int64
+	stats.Exact = true
+	err := t.db.View(func(txn *badger.Txn) error {
+		iterOpts := badger.DefaultIteratorOptions
+		iterOpts.PrefetchValues = false
+		it := txn.NewIterator(iterOpts)
+		defer it.Close()
+		for i, start := range starts {
+			var end []byte
+			if i+1 < len(starts) {
+				end = starts[i+1]
+			}
+			n := 0
+			for it.Seek(start); it.Valid(); it.Next() {
+				item := it.Item()
+				if end != nil && bytes.Compare(item.Key(), end) >= 0 {
+					break
+				}
+				if n == perStart {
+					stats.Exact = false
+					break
+				}
+				n++
+				prefix := string(opt.prefix(item.Key()))
+				b := buckets[prefix]
+				if b == nil {
+					b = new(bucket)
+					buckets[prefix] = b
+				}
+				size := int64(len(item.Key())) + item.EstimatedSize()
+				b.keys++
+				b.bytes += size
+				sampledBytes += size
+			}
+			stats.Sampled += n
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the memtables are not in EstimatedKeys
+	totalKeys := max(int64(stats.EstimatedKeys), int64(stats.Sampled))
+	totalBytes := max(stats.LSMSize+stats.VLogSize, sampledBytes)
+	for prefix, b := range buckets {
+		ps := PrefixStats{Prefix: prefix, Keys: b.keys, Bytes: b.bytes}
+		if !stats.Exact {
+			ps.Keys = b.keys * totalKeys / int64(stats.Sampled)
+			if sampledBytes > 0 {
+				ps.Bytes = b.bytes * totalBytes / sampledBytes
+			}
+		}
+		stats.Prefixes = append(stats.Prefixes, ps)
+	}
+	sort.Slice(stats.Prefixes, func(i, j int) bool {
+		if stats.Prefixes[i].Bytes != stats.Prefixes[j].Bytes {
+			return stats.Prefixes[i].Bytes > stats.Prefixes[j].Bytes
+		}
+		return stats.Prefixes[i].Prefix < stats.Prefixes[j].Prefix
+	})
+	return nil
+}
+
+func compactKeys(keys [][]byte) [][]byte {
+	out := keys[:0]
+	for _, key := range keys {
+		if len(out) > 0 && bytes.Equal(key, out[len(out)-1]) {
+			continue
+		}
+		out = append(out, key)
+	}
+	return out
+}
+
+type prefixReportOptions struct {
+	interval time.Duration
+	prefix   PrefixFunc
+	samples  int
+}
+
+// WithPrefixReport computes the prefix histogram of Stats every interval from New until
+// Close, exported as the db.badger.prefix.size and db.badger.prefix.keys gauges for the
+// MaxReportedPrefixes largest prefixes and OtherPrefix. The reports are not traced.
+func WithPrefixReport(interval time.Duration, fn PrefixFunc, samples int) Option {
+	return func(opt *option) {
+		opt.prefixReport = &prefixReportOptions{interval: interval, prefix: fn, samples: samples}
+	}
+}
+
+type prefixReporter struct {
+	db           *DB
+	options      prefixReportOptions
+	mu           sync.Mutex
+	prefixes     []PrefixStats
+	size         metric.Int64ObservableGauge
+	keys         metric.Int64ObservableGauge
+	registration metric.Registration
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+func newPrefixReporter(t *DB, options prefixReportOptions) (*prefixReporter, error) {
+	if options.interval <= 0 {
+		options.interval = DefaultPrefixReportInterval
+	}
+	r := &prefixReporter{db: t, options: options}
+	var err error
+	if r.size, err = t.meter.Int64ObservableGauge("db.badger.prefix.size",
+		metric.WithDescription("Estimated size of the keys and values per prefix"),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, err
+	}
+	if r.keys, err = t.meter.Int64ObservableGauge("db.badger.prefix.keys",
+		metric.WithDescription("Estimated number of keys per prefix"),
+		metric.WithUnit("{key}"),
+	); err != nil {
+		return nil, err
+	}
+	if r.registration, err = t.meter.RegisterCallback(r.observe, r.size, r.keys); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *prefixReporter) observe(ctx context.Context, o metric.Observer) error {
+	r.mu.Lock()
+	prefixes := r.prefixes
+	r.mu.Unlock()
+	for _, p := range prefixes {
+		attrs := metric.WithAttributes(append(append(make([]attribute.KeyValue, 0, len(r.db.attrs)+1), r.db.attrs...),
+			PrefixKey.String(safeString([]byte(p.Prefix))))...)
+		o.ObserveInt64(r.size, p.Bytes, attrs)
+		o.ObserveInt64(r.keys, p.Keys, attrs)
+	}
+	return nil
+}
+
+func (r *prefixReporter) start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	r.done = make(chan struct{})
+	go r.loop(ctx)
+}
+
+func (r *prefixReporter) stop() error {
+	if r == nil {
+		return nil
+	}
+	if r.cancel != nil {
+		r.cancel()
+		<-r.done
+	}
+	return r.registration.Unregister()
+}
+
+func (r *prefixReporter) loop(ctx context.Context) {
+	defer close(r.done)
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			stats, err := r.db.stats(statsOption{prefix: r.options.prefix, samples: r.options.samples})
+			if err != nil {
+				r.db.db.Opts().Logger.Errorf("error during a prefix report %s", err)
+			} else {
+				prefixes := topPrefixes(stats.Prefixes, MaxReportedPrefixes)
+				r.mu.Lock()
+				r.prefixes = prefixes
+				r.mu.Unlock()
+			}
+			t.Reset(r.options.interval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// topPrefixes keeps the n first prefixes, largest first, and sums the others under OtherPrefix
+// to bound the cardinality of the gauges.
+func topPrefixes(prefixes []PrefixStats, n int) []PrefixStats {
+	if len(prefixes) <= n {
+		return prefixes
+	}
+	top := append(make([]PrefixStats, 0, n+1), prefixes[:n]...)
+	other := PrefixStats{Prefix: OtherPrefix}
+	for _, p := range prefixes[n:] {
+		other.Keys += p.Keys
+		other.Bytes += p.Bytes
+	}
+	return append(top, other)
+}
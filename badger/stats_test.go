@@ -0,0 +1,75 @@
+package badger_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	for i := range 30 {
+		key := fmt.Sprintf("user:%d", i)
+		if i%3 == 0 {
+			key = fmt.Sprintf("order:%d", i)
+		}
+		assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte(key), []byte("value"))))
+	}
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("plain"), []byte("value"))))
+
+	stats, err := h.DB.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, stats.Prefixes)
+
+	stats, err = h.DB.Stats(ctx, badger.WithPrefixHistogram(badger.PrefixUntil(':'), 0))
+	assert.NoError(t, err)
+	assert.True(t, stats.Exact)
+	assert.Equal(t, 31, stats.Sampled)
+	keys := make(map[string]int64)
+	for _, p := range stats.Prefixes {
+		keys[p.Prefix] = p.Keys
+	}
+	assert.Equal(t, map[string]int64{"user:": 20, "order:": 10, "": 1}, keys)
+	assert.Equal(t, "user:", stats.Prefixes[0].Prefix)
+	h.AssertSpan(t, "db.stats", badger.StatsSampledKey.Int(31))
+}
+
+func TestPrefixReport(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t, badger.WithPrefixReport(10*time.Millisecond, badger.PrefixUntil(':'), 0))
+	for i := range badger.MaxReportedPrefixes + 5 {
+		key := fmt.Sprintf("p%03d:key", i)
+		assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte(key), []byte("value"))))
+	}
+
+	var prefixes map[string]int64
+	assert.Eventually(t, func() bool {
+		rm, err := h.Metrics(ctx)
+		if err != nil {
+			return false
+		}
+		prefixes = make(map[string]int64)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if gauge, ok := m.Data.(metricdata.Gauge[int64]); ok && m.Name == "db.badger.prefix.keys" {
+					for _, dp := range gauge.DataPoints {
+						prefix, _ := dp.Attributes.Value(badger.PrefixKey)
+						prefixes[prefix.AsString()] = dp.Value
+					}
+				}
+			}
+		}
+		return len(prefixes) == badger.MaxReportedPrefixes+1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(5), prefixes[badger.OtherPrefix])
+	// the background reports are not traced
+	h.AssertNoSpan(t, "db.stats")
+}
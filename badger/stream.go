@@ -0,0 +1,178 @@
+package badger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/ristretto/z"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	StreamKeysKey    = attribute.Key("db.badger.stream.keys")
+	StreamSkippedKey = attribute.Key("db.badger.stream.skipped")
+)
+
+const streamProgressInterval = 10 * time.Second
+
+// StreamTransform maps a streamed key and value to the ones written to the sink,
+// returning keep false drops the key.
+type StreamTransform = func(key []byte, value []byte) (outKey []byte, outValue []byte, keep bool)
+
+// StreamSink receives the kvs of Stream. Write is never called concurrently and
+// the kvs are owned by the sink. migrate.NewTableSink streams to a nutsdb table.
+type StreamSink interface {
+	Write(ctx context.Context, kvs []*KV) error
+	Close(ctx context.Context) error
+}
+
+// Stream reads the latest version of every key with prefix using numGo goroutines,
+// passes it through transform, which may be nil, and writes the result to sink.
+// The sink is closed once the stream ends. Progress is logged through a BadgerLogger
+// built from ctx.
+func (t *DB) Stream(ctx context.Context, prefix []byte, numGo int, transform StreamTransform, sink StreamSink) error {
+	return t.withSpan(ctx, "db.stream", "stream", prefix,
+		func(ctx context.Context) error {
+			var (
+				logger    = NewBadgerLogger(ctx, 1)
+				startTime = time.Now()
+				lastLog   = startTime
+				written   int
+				skipped   int
+				bytesRead int
+				sinkErr   error
+			)
+			stream := t.db.NewStream()
+			stream.LogPrefix = "DB.Stream"
+			stream.Prefix = prefix
+			if numGo > 0 {
+				stream.NumGo = numGo
+			}
+			stream.Send = func(buf *z.Buffer) error {
+				list, err := badger.BufferToKVList(buf)
+				if err != nil {
+					return err
+				}
+				kvs := make([]*KV, 0, len(list.Kv))
+				for _, kv := range list.Kv {
+					bytesRead += len(kv.Key) + len(kv.Value)
+					key, value := kv.Key, kv.Value
+					if transform != nil {
+						var keep bool
+						if key, value, keep = transform(key, value); !keep {
+							skipped++
+							continue
+						}
+					}
+					kvs = append(kvs, &KV{
+						Key:       key,
+						Value:     value,
+						Version:   kv.Version,
+						ExpiresAt: kv.ExpiresAt,
+					})
+				}
+				if len(kvs) > 0 {
+					if err := sink.Write(ctx, kvs); err != nil {
+						sinkErr = err
+						return err
+					}
+				}
+				written += len(kvs)
+				if time.Since(lastLog) >= streamProgressInterval {
+					lastLog = time.Now()
+					logger.Infof("DB.Stream written %d keys, skipped %d, read %d bytes in %s",
+						written, skipped, bytesRead, time.Since(startTime).Round(time.Second))
+				}
+				return nil
+			}
+			err := stream.Orchestrate(ctx)
+			// Orchestrate may report the cancellation caused by the failed Send instead
+			if sinkErr != nil {
+				err = sinkErr
+			}
+			if e := sink.Close(ctx); err == nil {
+				err = e
+			}
+			if err != nil {
+				logger.Errorf("DB.Stream failed after %d keys: %s", written, err)
+			} else {
+				logger.Infof("DB.Stream done, written %d keys, skipped %d, read %d bytes in %s",
+					written, skipped, bytesRead, time.Since(startTime).Round(time.Millisecond))
+			}
+			if span := t.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(
+					StreamKeysKey.Int(written),
+					StreamSkippedKey.Int(skipped),
+					BytesReadKey.Int(bytesRead),
+				)
+			}
+			return err
+		})
+}
+
+type dbSink struct {
+	batch *BatchWriter
+}
+
+// NewDBSink writes the streamed kvs to another badger store through a BatchWriter,
+// keeping their expiry.
+func NewDBSink(db *DB, options ...BatchOption) StreamSink {
+	return &dbSink{batch: db.NewBatchWriter(options...)}
+}
+
+func (s *dbSink) Write(ctx context.Context, kvs []*KV) error {
+	for _, kv := range kvs {
+		entry := badger.NewEntry(kv.Key, kv.Value)
+		entry.ExpiresAt = kv.ExpiresAt
+		if err := s.batch.SetEntry(ctx, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *dbSink) Close(ctx context.Context) error {
+	return s.batch.Close(ctx)
+}
+
+// StreamRecord is one line written by the sink of NewWriterSink, key and value
+// are base64 encoded by encoding/json.
+type StreamRecord struct {
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	Version   uint64 `json:"version,omitempty"`
+	ExpiresAt uint64 `json:"expires_at,omitempty"`
+}
+
+type writerSink struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewWriterSink writes the streamed kvs to w as JSON lines of StreamRecord.
+func NewWriterSink(w io.Writer) StreamSink {
+	buf := bufio.NewWriter(w)
+	return &writerSink{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (s *writerSink) Write(ctx context.Context, kvs []*KV) error {
+	for _, kv := range kvs {
+		if err := s.enc.Encode(&StreamRecord{
+			Key:       kv.Key,
+			Value:     kv.Value,
+			Version:   kv.Version,
+			ExpiresAt: kv.ExpiresAt,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *writerSink) Close(ctx context.Context) error {
+	return s.buf.Flush()
+}
@@ -0,0 +1,100 @@
+package badger_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func fillStream(t *testing.T, h *badgertest.Harness) {
+	var entries []*dgbadger.Entry
+	for i := range 100 {
+		entries = append(entries, dgbadger.NewEntry([]byte(fmt.Sprintf("user:%03d", i)), []byte(fmt.Sprint(i))))
+	}
+	entries = append(entries,
+		dgbadger.NewEntry([]byte("user:ttl"), []byte("t")).WithTTL(time.Hour),
+		dgbadger.NewEntry([]byte("order:1"), []byte("o")))
+	assert.NoError(t, h.DB.Update(context.Background(), entries...))
+}
+
+func TestStreamDBSink(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	fillStream(t, h)
+	target := badgertest.New(t)
+
+	// keys of even users are renamed, the odd ones dropped
+	transform := func(key []byte, value []byte) ([]byte, []byte, bool) {
+		var n int
+		if _, err := fmt.Sscanf(string(key), "user:%d", &n); err == nil && n%2 == 1 {
+			return nil, nil, false
+		}
+		return append([]byte("copy:"), key...), value, true
+	}
+	assert.NoError(t, h.DB.Stream(ctx, []byte("user:"), 2, transform, badger.NewDBSink(target.DB)))
+	h.AssertSpan(t, "db.stream", badger.StreamKeysKey.Int(51), badger.StreamSkippedKey.Int(50))
+
+	keys := scanKeys(t, target.DB, nil)
+	assert.Len(t, keys, 51)
+	assert.Equal(t, "copy:user:000", keys[0])
+	assert.Equal(t, "copy:user:ttl", keys[50])
+	ttl, err := target.DB.GetTTL(ctx, []byte("copy:user:ttl"))
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Minute))
+}
+
+func TestStreamWriterSink(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	fillStream(t, h)
+
+	var buf bytes.Buffer
+	assert.NoError(t, h.DB.Stream(ctx, []byte("order:"), 1, nil, badger.NewWriterSink(&buf)))
+	scanner := bufio.NewScanner(&buf)
+	var records []badger.StreamRecord
+	for scanner.Scan() {
+		var record badger.StreamRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "order:1", string(records[0].Key))
+		assert.Equal(t, "o", string(records[0].Value))
+		assert.Positive(t, records[0].Version)
+	}
+}
+
+type failingSink struct {
+	err    error
+	closed bool
+}
+
+func (s *failingSink) Write(ctx context.Context, kvs []*badger.KV) error {
+	return s.err
+}
+
+func (s *failingSink) Close(ctx context.Context) error {
+	s.closed = true
+	return nil
+}
+
+func TestStreamSinkError(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	fillStream(t, h)
+
+	sink := &failingSink{err: errors.New("disk full")}
+	assert.ErrorIs(t, h.DB.Stream(ctx, nil, 1, nil, sink), sink.err)
+	assert.True(t, sink.closed)
+	h.AssertSpanError(t, "db.stream")
+}
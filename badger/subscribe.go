@@ -0,0 +1,409 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync/atomic"
+
+	"github.com/XiBao/db/model"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	SubscribeVersionKey = attribute.Key("db.badger.subscribe.version")
+	SubscribeReplayKey  = attribute.Key("db.badger.subscribe.replay")
+)
+
+const (
+	DefaultSubscribeBuffer    = 16
+	DefaultSubscribeBatchSize = 1000
+)
+
+// Checkpoint stores the version up to which a subscription has been handled.
+type Checkpoint interface {
+	Load(ctx context.Context) (uint64, error)
+	Save(ctx context.Context, version uint64) error
+}
+
+type dbCheckpoint struct {
+	db  *DB
+	key []byte
+}
+
+// NewDBCheckpoint stores the checkpoint under key in db. The writes of the checkpoint
+// are never delivered to the subscription using it.
+func NewDBCheckpoint(db *DB, key []byte) Checkpoint {
+	return &dbCheckpoint{db: db, key: key}
+}
+
+func (c *dbCheckpoint) Load(ctx context.Context) (version uint64, err error) {
+	err = c.db.View(ctx, c.key, func(val []byte) error {
+		if len(val) == 8 {
+			version = binary.BigEndian.Uint64(val)
+		}
+		return nil
+	})
+	if errors.Is(err, model.ErrNotFound) {
+		err = nil
+	}
+	return
+}
+
+func (c *dbCheckpoint) Save(ctx context.Context, version uint64) error {
+	return c.db.Update(ctx, badger.NewEntry(c.key, binary.BigEndian.AppendUint64(nil, version)))
+}
+
+type subscribeOption struct {
+	checkpoint Checkpoint
+	fromStart  bool
+	buffer     int
+	batchSize  int
+}
+
+type SubscribeOption = func(opt *subscribeOption)
+
+// WithCheckpoint resumes the subscription after the version stored in checkpoint,
+// saved after every batch handled without error.
+func WithCheckpoint(checkpoint Checkpoint) SubscribeOption {
+	return func(opt *subscribeOption) {
+		opt.checkpoint = checkpoint
+	}
+}
+
+// WithSubscribeFromStart makes a checkpoint holding no version yet replay every version
+// kept by badger, by default the subscription then starts from the current version.
+func WithSubscribeFromStart(enabled bool) SubscribeOption {
+	return func(opt *subscribeOption) {
+		opt.fromStart = enabled
+	}
+}
+
+// WithSubscribeBuffer sets how many batches wait for the handler. Once they are
+// queued the next updates are dropped, never making the writes of the db wait, and read
+// back from the db after the version last delivered once the handler caught up.
+func WithSubscribeBuffer(n int) SubscribeOption {
+	return func(opt *subscribeOption) {
+		opt.buffer = n
+	}
+}
+
+// WithSubscribeBatchSize caps the number of events passed to one handler call.
+func WithSubscribeBatchSize(n int) SubscribeOption {
+	return func(opt *subscribeOption) {
+		opt.batchSize = n
+	}
+}
+
+// Subscribe calls handler with the writes of the keys with one of prefixes, every key
+// when there is none, in version order until ctx is done or handler fails.
+//
+// With a checkpoint, the versions written since the checkpoint still kept by badger are
+// replayed first, a key whose older versions were compacted is only replayed at its
+// latest one. A new checkpoint is saved at the current version, see
+// WithSubscribeFromStart. Events are delivered at least once: a batch whose handler fails
+// is delivered again by the next Subscribe with the same checkpoint. A slow handler never
+// makes the writes of the db wait, see WithSubscribeBuffer. Deleted is set for deletes
+// and, when replayed, for expired entries.
+func (t *DB) Subscribe(ctx context.Context, prefixes [][]byte, handler func(ctx context.Context, events []*KV) error, options ...SubscribeOption) error {
+	opt := &subscribeOption{
+		buffer:    DefaultSubscribeBuffer,
+		batchSize: DefaultSubscribeBatchSize,
+	}
+	for _, o := range options {
+		o(opt)
+	}
+	s := &subscription{
+		db:       t,
+		opt:      opt,
+		prefixes: prefixes,
+		handler:  handler,
+	}
+	if len(s.prefixes) == 0 {
+		s.prefixes = [][]byte{{}}
+	}
+	if cp, ok := opt.checkpoint.(*dbCheckpoint); ok && cp.db == t {
+		s.skipKey = cp.key
+	}
+	return s.run(ctx)
+}
+
+type subscription struct {
+	db       *DB
+	opt      *subscribeOption
+	prefixes [][]byte
+	handler  func(ctx context.Context, events []*KV) error
+	skipKey  []byte
+	// version is the highest version delivered
+	version uint64
+	// synced is set once a live batch proved that badger's subscriber was registered
+	synced bool
+	// dropping is set by badger's publisher once the queue is full, until the
+	// subscription read the dropped updates back
+	dropping atomic.Bool
+}
+
+func (s *subscription) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if s.opt.checkpoint != nil {
+		version, err := s.opt.checkpoint.Load(ctx)
+		if err != nil {
+			return err
+		}
+		if version == 0 && !s.opt.fromStart {
+			txn := s.db.db.NewTransaction(false)
+			version = txn.ReadTs()
+			txn.Discard()
+			if err := s.opt.checkpoint.Save(ctx, version); err != nil {
+				return err
+			}
+		}
+		s.version = version
+	} else {
+		// replayed from when the queue overflows
+		txn := s.db.db.NewTransaction(false)
+		s.version = txn.ReadTs()
+		txn.Discard()
+	}
+
+	matches := make([]pb.Match, 0, len(s.prefixes))
+	for _, prefix := range s.prefixes {
+		matches = append(matches, pb.Match{Prefix: prefix})
+	}
+	var (
+		queue    = make(chan []*KV, max(s.opt.buffer, 1))
+		overflow = make(chan struct{}, 1)
+		done     = make(chan error, 1)
+	)
+	// the callback runs in badger's publisher, which the commits of the db wait for once
+	// its own queue is full: it must neither block nor read the db
+	go func() {
+		done <- s.db.db.Subscribe(ctx, func(list *badger.KVList) error {
+			if s.dropping.Load() {
+				return nil
+			}
+			events := s.events(list)
+			if len(events) == 0 {
+				return nil
+			}
+			select {
+			case queue <- events:
+			default:
+				s.dropping.Store(true)
+				select {
+				case overflow <- struct{}{}:
+				default:
+				}
+			}
+			return nil
+		}, matches)
+	}()
+
+	// badger registers the subscriber asynchronously, the writes made before are
+	// replayed again up to the first live batch
+	if s.opt.checkpoint != nil {
+		if err := s.replay(ctx, s.version, 0); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case events := <-queue:
+			if err := s.deliverLive(ctx, events); err != nil {
+				return err
+			}
+		case <-overflow:
+			if err := s.recover(ctx, queue); err != nil {
+				return err
+			}
+		case err := <-done:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+}
+
+// recover delivers the batches queued before the overflow, then reads back the dropped
+// ones. Updates published once dropping is reset are queued again, those the replay
+// already delivered are skipped by version.
+func (s *subscription) recover(ctx context.Context, queue chan []*KV) error {
+	for drained := false; !drained; {
+		select {
+		case events := <-queue:
+			if err := s.deliverLive(ctx, events); err != nil {
+				return err
+			}
+		default:
+			drained = true
+		}
+	}
+	s.dropping.Store(false)
+	s.synced = true
+	return s.replay(ctx, s.version, 0)
+}
+
+// internalPrefix starts the keys badger writes for itself, such as the commit markers
+// published along with the transactions.
+var internalPrefix = []byte("!badger!")
+
+// events converts a badger update to events, without the checkpoint writes.
+func (s *subscription) events(list *badger.KVList) []*KV {
+	events := make([]*KV, 0, len(list.Kv))
+	for _, kv := range list.Kv {
+		if (s.skipKey != nil && bytes.Equal(kv.Key, s.skipKey)) || bytes.HasPrefix(kv.Key, internalPrefix) {
+			continue
+		}
+		events = append(events, &KV{
+			Key:       kv.Key,
+			Value:     kv.Value,
+			Version:   kv.Version,
+			ExpiresAt: kv.ExpiresAt,
+		})
+	}
+	return events
+}
+
+// resolveDeletes sets Deleted on live events. The update only carries the user meta, not
+// badger's delete bit, so the versions of the empty values are read back in one View.
+func (s *subscription) resolveDeletes(events []*KV) error {
+	var empty []*KV
+	for _, event := range events {
+		if len(event.Value) == 0 {
+			empty = append(empty, event)
+		}
+	}
+	if len(empty) == 0 {
+		return nil
+	}
+	return s.db.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.AllVersions = true
+		opts.PrefetchValues = false
+		for _, event := range empty {
+			event.Deleted = isDeletedAt(txn, opts, event.Key, event.Version)
+		}
+		return nil
+	})
+}
+
+// isDeletedAt tells whether the version of key is a delete, or expired.
+func isDeletedAt(txn *badger.Txn, opts badger.IteratorOptions, key []byte, version uint64) bool {
+	it := txn.NewKeyIterator(key, opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if item.Version() < version {
+			break
+		}
+		if item.Version() == version {
+			return item.IsDeletedOrExpired()
+		}
+	}
+	return false
+}
+
+func (s *subscription) deliverLive(ctx context.Context, events []*KV) error {
+	if len(events) == 0 {
+		return nil
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Version < events[j].Version
+	})
+	if !s.synced {
+		s.synced = true
+		if s.opt.checkpoint != nil {
+			if err := s.replay(ctx, s.version, events[0].Version); err != nil {
+				return err
+			}
+		}
+	}
+	live := events[:0]
+	for _, event := range events {
+		if event.Version > s.version {
+			live = append(live, event)
+		}
+	}
+	if err := s.resolveDeletes(live); err != nil {
+		return err
+	}
+	return s.deliver(ctx, live, false)
+}
+
+// replay delivers the versions kept by badger newer than since and older than until,
+// all of them when until is 0.
+func (s *subscription) replay(ctx context.Context, since uint64, until uint64) error {
+	var events []*KV
+	if err := s.db.db.View(func(txn *badger.Txn) error {
+		for _, prefix := range s.prefixes {
+			if _, err := scanTxn(txn, &ScanOptions{Prefix: prefix, AllVersions: true}, func(kv *KV) error {
+				if kv.Version <= since || (until > 0 && kv.Version >= until) {
+					return nil
+				}
+				if s.skipKey != nil && bytes.Equal(kv.Key, s.skipKey) {
+					return nil
+				}
+				events = append(events, &KV{
+					Key:       append([]byte(nil), kv.Key...),
+					Value:     append([]byte(nil), kv.Value...),
+					Version:   kv.Version,
+					ExpiresAt: kv.ExpiresAt,
+					Deleted:   kv.Deleted,
+				})
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Version < events[j].Version
+	})
+	return s.deliver(ctx, events, true)
+}
+
+func (s *subscription) deliver(ctx context.Context, events []*KV, replay bool) error {
+	for len(events) > 0 {
+		n := len(events)
+		if s.opt.batchSize > 0 {
+			n = min(n, s.opt.batchSize)
+		}
+		// versions are only checkpointed once all events of the version are handled
+		for n < len(events) && events[n].Version == events[n-1].Version {
+			n++
+		}
+		batch := events[:n]
+		version := batch[len(batch)-1].Version
+		if err := s.db.withSpan(ctx, "db.subscribe.batch", "subscribe", []byte{},
+			func(ctx context.Context) error {
+				if span := s.db.span(ctx); span != nil && span.IsRecording() {
+					span.SetAttributes(
+						BatchEntriesKey.Int(len(batch)),
+						SubscribeVersionKey.Int64(int64(version)),
+						SubscribeReplayKey.Bool(replay),
+					)
+				}
+				if err := s.handler(ctx, batch); err != nil {
+					return err
+				}
+				if s.opt.checkpoint != nil && version > s.version {
+					return s.opt.checkpoint.Save(ctx, version)
+				}
+				return nil
+			}); err != nil {
+			return err
+		}
+		s.version = max(s.version, version)
+		events = events[n:]
+	}
+	return nil
+}
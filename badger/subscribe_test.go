@@ -0,0 +1,176 @@
+package badger_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type subscriber struct {
+	events chan badger.KV
+	cancel context.CancelFunc
+	done   chan error
+}
+
+func subscribe(h *badgertest.Harness, fail func(kv *badger.KV) bool, options ...badger.SubscribeOption) *subscriber {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &subscriber{events: make(chan badger.KV, 100), cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		s.done <- h.DB.Subscribe(ctx, [][]byte{[]byte("k")}, func(ctx context.Context, events []*badger.KV) error {
+			for _, kv := range events {
+				if fail != nil && fail(kv) {
+					return errFailed
+				}
+				s.events <- *kv
+			}
+			return nil
+		}, options...)
+	}()
+	return s
+}
+
+var errFailed = errors.New("failed")
+
+func (s *subscriber) next(t *testing.T) badger.KV {
+	t.Helper()
+	select {
+	case kv := <-s.events:
+		return kv
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+		return badger.KV{}
+	}
+}
+
+func (s *subscriber) stop() error {
+	s.cancel()
+	return <-s.done
+}
+
+func TestSubscribeDeletes(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	s := subscribe(h, nil, badger.WithCheckpoint(badger.NewDBCheckpoint(h.DB, []byte("cp"))),
+		badger.WithSubscribeFromStart(true))
+	defer s.stop()
+
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("k1"), []byte("v1"))))
+	assert.NoError(t, h.DB.Delete(ctx, []byte("k1")))
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("k2"), nil)))
+
+	for _, want := range []struct {
+		key     string
+		deleted bool
+	}{{"k1", false}, {"k1", true}, {"k2", false}} {
+		kv := s.next(t)
+		assert.Equal(t, want.key, string(kv.Key))
+		assert.Equal(t, want.deleted, kv.Deleted, want.key)
+	}
+	h.AssertSpan(t, "db.subscribe.batch")
+}
+
+func TestSubscribeCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	checkpoint := badger.NewDBCheckpoint(h.DB, []byte("cp"))
+	set := func(key string) {
+		assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte(key), []byte("v"))))
+	}
+	set("k0")
+
+	// a new checkpoint starts at the current version instead of replaying k0
+	s := subscribe(h, nil, badger.WithCheckpoint(checkpoint))
+	assert.Eventually(t, func() bool {
+		version, err := checkpoint.Load(ctx)
+		return err == nil && version > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	set("k1")
+	assert.Equal(t, "k1", string(s.next(t).Key))
+	assert.ErrorIs(t, s.stop(), context.Canceled)
+
+	// written while nobody listens, k3 fails once
+	set("k2")
+	set("k3")
+	s = subscribe(h, func(kv *badger.KV) bool {
+		return string(kv.Key) == "k3"
+	}, badger.WithCheckpoint(checkpoint), badger.WithSubscribeBatchSize(1))
+	assert.Equal(t, "k2", string(s.next(t).Key))
+	assert.ErrorIs(t, <-s.done, errFailed)
+
+	s = subscribe(h, nil, badger.WithCheckpoint(checkpoint))
+	defer s.stop()
+	assert.Equal(t, "k3", string(s.next(t).Key))
+	set("k4")
+	assert.Equal(t, "k4", string(s.next(t).Key))
+	select {
+	case kv := <-s.events:
+		t.Errorf("unexpected event %s", kv.Key)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSubscribeBackpressure(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	checkpoint := badger.NewDBCheckpoint(h.DB, []byte("cp"))
+	release := make(chan struct{})
+	seen := make(map[string]bool)
+	var mu sync.Mutex
+	sctx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		// every key, the checkpoint included, with the smallest queue
+		done <- h.DB.Subscribe(sctx, nil, func(ctx context.Context, events []*badger.KV) error {
+			<-release
+			mu.Lock()
+			defer mu.Unlock()
+			for _, kv := range events {
+				assert.Equal(t, byte('k'), kv.Key[0], "key %q", kv.Key)
+				seen[string(kv.Key)] = true
+			}
+			return nil
+		}, badger.WithCheckpoint(checkpoint), badger.WithSubscribeFromStart(true),
+			badger.WithSubscribeBuffer(1), badger.WithSubscribeBatchSize(1))
+	}()
+
+	// far more updates than the queues of the subscription and of badger's publisher hold
+	const n = 3000
+	written := make(chan error, 1)
+	go func() {
+		for i := range n {
+			if err := h.DB.Update(ctx, dgbadger.NewEntry([]byte(fmt.Sprintf("k%04d", i)), []byte("v"))); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+	select {
+	case err := <-written:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("writes blocked by the subscription")
+	}
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen) == n
+	}, 10*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// the checkpoint writes were saved while the handler was behind
+	version, err := checkpoint.Load(ctx)
+	assert.NoError(t, err)
+	assert.Positive(t, version)
+}
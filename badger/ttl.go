@@ -0,0 +1,111 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	TTLKey       = attribute.Key("db.badger.ttl")
+	ExpiresAtKey = attribute.Key("db.badger.expires_at")
+)
+
+// PersistentTTL is returned by GetTTL for keys without expiry, like the -1 of nutsdb.Table.GetTTL.
+const PersistentTTL time.Duration = -1
+
+// ErrNegativeTTL is returned by SetWithTTL and Touch for a negative ttl.
+var ErrNegativeTTL = errors.New("negative ttl")
+
+// SetWithTTL writes key expiring after ttl, a zero ttl writes it without expiry like
+// nutsdb.Persistent.
+func (t *DB) SetWithTTL(ctx context.Context, key []byte, value []byte, ttl time.Duration) error {
+	return t.withSpan(ctx, "db.set", "set", key,
+		func(ctx context.Context) error {
+			if span := t.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(TTLKey.String(ttl.String()))
+			}
+			if ttl < 0 {
+				return ErrNegativeTTL
+			}
+			return t.updateWithRetry(ctx, func(txn *badger.Txn) error {
+				entry := badger.NewEntry(key, value)
+				if ttl > 0 {
+					entry = entry.WithTTL(ttl)
+				}
+				return txn.SetEntry(entry)
+			})
+		})
+}
+
+// Touch makes key expire ttl from now, see Expire, a zero ttl persists it like SetWithTTL.
+func (t *DB) Touch(ctx context.Context, key []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		return ErrNegativeTTL
+	}
+	var expiresAt uint64
+	if ttl > 0 {
+		expiresAt = uint64(time.Now().Add(ttl).Unix())
+	}
+	return t.setExpiry(ctx, "db.touch", "touch", key, expiresAt)
+}
+
+// Expire makes key expire at at. Badger can not change the expiry of a version, so
+// the value is written again with the new expiry in one transaction, keeping its user meta.
+func (t *DB) Expire(ctx context.Context, key []byte, at time.Time) error {
+	return t.setExpiry(ctx, "db.expire", "expire", key, uint64(at.Unix()))
+}
+
+// Persist clears the expiry of key, rewriting its value like Expire.
+func (t *DB) Persist(ctx context.Context, key []byte) error {
+	return t.setExpiry(ctx, "db.persist", "persist", key, 0)
+}
+
+// GetTTL returns the remaining time to live of key, PersistentTTL when it does not expire.
+func (t *DB) GetTTL(ctx context.Context, key []byte) (ttl time.Duration, err error) {
+	err = t.withSpan(ctx, "db.get_ttl", "get_ttl", key,
+		func(ctx context.Context) error {
+			return t.db.View(func(txn *badger.Txn) error {
+				item, err := txn.Get(key)
+				if err != nil {
+					return mapError(err)
+				}
+				if item.ExpiresAt() == 0 {
+					ttl = PersistentTTL
+				} else {
+					ttl = max(time.Until(time.Unix(int64(item.ExpiresAt()), 0)), 0)
+				}
+				return nil
+			})
+		})
+	return
+}
+
+// setExpiry rewrites the latest version of key with expiresAt, 0 for no expiry.
+func (t *DB) setExpiry(ctx context.Context, spanName string, operation string, key []byte, expiresAt uint64) error {
+	return t.withSpan(ctx, spanName, operation, key,
+		func(ctx context.Context) error {
+			if span := t.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(ExpiresAtKey.Int64(int64(expiresAt)))
+			}
+			return t.updateWithRetry(ctx, func(txn *badger.Txn) error {
+				item, err := txn.Get(key)
+				if err != nil {
+					return mapError(err)
+				}
+				if item.ExpiresAt() == expiresAt {
+					return nil
+				}
+				value, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				entry := badger.NewEntry(key, value).WithMeta(item.UserMeta())
+				entry.ExpiresAt = expiresAt
+				return txn.SetEntry(entry)
+			})
+		})
+}
@@ -0,0 +1,87 @@
+package badger_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	"github.com/XiBao/db/model"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetWithTTL(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+
+	assert.NoError(t, h.DB.SetWithTTL(ctx, []byte("persistent"), []byte("v"), 0))
+	ttl, err := h.DB.GetTTL(ctx, []byte("persistent"))
+	assert.NoError(t, err)
+	assert.Equal(t, badger.PersistentTTL, ttl)
+
+	assert.NoError(t, h.DB.SetWithTTL(ctx, []byte("expiring"), []byte("v"), time.Hour))
+	ttl, err = h.DB.GetTTL(ctx, []byte("expiring"))
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Minute))
+
+	assert.ErrorIs(t, h.DB.SetWithTTL(ctx, []byte("negative"), []byte("v"), -time.Second), badger.ErrNegativeTTL)
+}
+
+func TestTouch(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("k"), []byte("v")).WithMeta(7)))
+	ttl := func() time.Duration {
+		ttl, err := h.DB.GetTTL(ctx, []byte("k"))
+		assert.NoError(t, err)
+		return ttl
+	}
+
+	assert.NoError(t, h.DB.Touch(ctx, []byte("k"), time.Hour))
+	assert.InDelta(t, time.Hour, ttl(), float64(time.Minute))
+	h.AssertSpan(t, "db.touch")
+
+	// like SetWithTTL, zero means no expiry
+	assert.NoError(t, h.DB.Touch(ctx, []byte("k"), 0))
+	assert.Equal(t, badger.PersistentTTL, ttl())
+	assert.ErrorIs(t, h.DB.Touch(ctx, []byte("k"), -time.Second), badger.ErrNegativeTTL)
+	assert.Equal(t, badger.PersistentTTL, ttl())
+	assert.ErrorIs(t, h.DB.Touch(ctx, []byte("missing"), time.Hour), model.ErrNotFound)
+
+	// the value and its user meta are written again with the new expiry
+	assert.NoError(t, h.DB.DB().View(func(txn *dgbadger.Txn) error {
+		item, err := txn.Get([]byte("k"))
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, byte(7), item.UserMeta())
+		value, err := item.ValueCopy(nil)
+		assert.Equal(t, "v", string(value))
+		return err
+	}))
+}
+
+func TestExpireAndPersist(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	assert.NoError(t, h.DB.SetWithTTL(ctx, []byte("k"), []byte("v"), time.Minute))
+
+	assert.NoError(t, h.DB.Expire(ctx, []byte("k"), time.Now().Add(2*time.Hour)))
+	ttl, err := h.DB.GetTTL(ctx, []byte("k"))
+	assert.NoError(t, err)
+	assert.InDelta(t, 2*time.Hour, ttl, float64(time.Minute))
+
+	assert.NoError(t, h.DB.Persist(ctx, []byte("k")))
+	ttl, err = h.DB.GetTTL(ctx, []byte("k"))
+	assert.NoError(t, err)
+	assert.Equal(t, badger.PersistentTTL, ttl)
+	h.AssertSpan(t, "db.persist")
+
+	// an expiry in the past removes the key
+	assert.NoError(t, h.DB.Expire(ctx, []byte("k"), time.Now().Add(-time.Hour)))
+	_, err = h.DB.GetTTL(ctx, []byte("k"))
+	assert.ErrorIs(t, err, model.ErrNotFound)
+	assert.ErrorIs(t, h.DB.Persist(ctx, []byte("k")), model.ErrNotFound)
+}
@@ -0,0 +1,143 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var RetriesKey = attribute.Key("db.badger.retries")
+
+const (
+	DefaultConflictRetries = 5
+	DefaultConflictBackoff = 10 * time.Millisecond
+)
+
+// Txn wraps a badger.Txn run by RunTxn, every operation gets a child span of the transaction span.
+type Txn struct {
+	db  *DB
+	txn *badger.Txn
+	ctx context.Context
+}
+
+// Txn returns the underlying badger.Txn.
+func (x *Txn) Txn() *badger.Txn {
+	return x.txn
+}
+
+// Get returns a copy of the value of key.
+func (x *Txn) Get(key []byte) (value []byte, err error) {
+	err = x.db.withSpan(x.ctx, "db.get", "get", key,
+		func(ctx context.Context) error {
+			item, err := x.txn.Get(key)
+			if err != nil {
+				return mapError(err)
+			}
+			value, err = item.ValueCopy(nil)
+			return err
+		})
+	return
+}
+
+// View calls fn with the value of key, the value is only valid inside fn.
+func (x *Txn) View(key []byte, fn func(val []byte) error) error {
+	return x.db.withSpan(x.ctx, "db.view", "view", key,
+		func(ctx context.Context) error {
+			item, err := x.txn.Get(key)
+			if err != nil {
+				return mapError(err)
+			}
+			return item.Value(fn)
+		})
+}
+
+func (x *Txn) Set(key []byte, value []byte) error {
+	return x.SetEntry(badger.NewEntry(key, value))
+}
+
+func (x *Txn) SetEntry(entry *badger.Entry) error {
+	return x.db.withSpan(x.ctx, "db.set", "set", entry.Key,
+		func(ctx context.Context) error {
+			return mapError(x.txn.SetEntry(entry))
+		})
+}
+
+func (x *Txn) Delete(key []byte) error {
+	return x.db.withSpan(x.ctx, "db.delete", "delete", key,
+		func(ctx context.Context) error {
+			return mapError(x.txn.Delete(key))
+		})
+}
+
+// Scan is DB.Scan within the transaction.
+func (x *Txn) Scan(opts *ScanOptions, fn func(kv *KV) error) error {
+	if opts == nil {
+		opts = new(ScanOptions)
+	}
+	return x.db.withSpan(x.ctx, "db.scan", "scan", opts.spanKey(),
+		func(ctx context.Context) error {
+			stats, err := scanTxn(x.txn, opts, fn)
+			x.db.recordScan(ctx, stats)
+			return err
+		})
+}
+
+// RunTxn runs fn in a transaction, read-write when update is true, and commits it when
+// fn returns nil. The transaction is always discarded and is run again from scratch
+// when the commit fails with badger.ErrConflict.
+func (t *DB) RunTxn(ctx context.Context, update bool, fn func(txn *Txn) error) error {
+	operation := "view"
+	if update {
+		operation = "update"
+	}
+	return t.withSpan(ctx, "db.txn", operation, []byte{},
+		func(ctx context.Context) error {
+			return t.retryOnConflict(ctx, func() error {
+				txn := t.db.NewTransaction(update)
+				defer txn.Discard()
+				if err := fn(&Txn{db: t, txn: txn, ctx: ctx}); err != nil {
+					return err
+				}
+				if !update {
+					return nil
+				}
+				return txn.Commit()
+			})
+		})
+}
+
+// updateWithRetry runs fn in a read-write transaction, see retryOnConflict.
+func (t *DB) updateWithRetry(ctx context.Context, fn func(txn *badger.Txn) error) error {
+	return t.retryOnConflict(ctx, func() error {
+		return t.db.Update(fn)
+	})
+}
+
+// retryOnConflict retries fn up to DefaultConflictRetries times while it fails with
+// badger.ErrConflict, the linear backoff is jittered so that conflicting writers do not
+// retry in lockstep.
+func (t *DB) retryOnConflict(ctx context.Context, fn func() error) error {
+	var retries int
+	defer func() {
+		if span := t.span(ctx); span != nil && span.IsRecording() && retries > 0 {
+			span.SetAttributes(RetriesKey.Int(retries))
+		}
+	}()
+	for {
+		err := fn()
+		if !errors.Is(err, badger.ErrConflict) || retries >= DefaultConflictRetries {
+			return err
+		}
+		retries++
+		backoff := DefaultConflictBackoff*time.Duration(retries) + rand.N(DefaultConflictBackoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package badger_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	"github.com/XiBao/db/model"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunTxnCommit(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("a"), []byte("1"))))
+
+	assert.NoError(t, h.DB.RunTxn(ctx, true, func(txn *badger.Txn) error {
+		value, err := txn.Get([]byte("a"))
+		if err != nil {
+			return err
+		}
+		if err := txn.Set([]byte("b"), append(value, '2')); err != nil {
+			return err
+		}
+		if err := txn.Delete([]byte("a")); err != nil {
+			return err
+		}
+		// the scan sees the transaction's own writes
+		var keys []string
+		err = txn.Scan(nil, func(kv *badger.KV) error {
+			keys = append(keys, string(kv.Key))
+			return nil
+		})
+		assert.Equal(t, []string{"b"}, keys)
+		return err
+	}))
+	assert.Equal(t, []string{"b"}, scanKeys(t, h.DB, nil))
+	assert.NoError(t, h.DB.View(ctx, []byte("b"), func(val []byte) error {
+		assert.Equal(t, "12", string(val))
+		return nil
+	}))
+}
+
+func TestRunTxnRollback(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	boom := errors.New("boom")
+	err := h.DB.RunTxn(ctx, true, func(txn *badger.Txn) error {
+		if err := txn.Set([]byte("a"), []byte("1")); err != nil {
+			return err
+		}
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, []string{}, scanKeys(t, h.DB, nil))
+	h.AssertSpanError(t, "db.txn")
+
+	// a read-only transaction refuses writes
+	err = h.DB.RunTxn(ctx, false, func(txn *badger.Txn) error {
+		return txn.Set([]byte("a"), []byte("1"))
+	})
+	assert.ErrorIs(t, err, dgbadger.ErrReadOnlyTxn)
+
+	err = h.DB.RunTxn(ctx, false, func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("a"))
+		return err
+	})
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestRunTxnConflictRetry(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("n"), []byte("1"))))
+
+	var attempts int
+	assert.NoError(t, h.DB.RunTxn(ctx, true, func(txn *badger.Txn) error {
+		attempts++
+		value, err := txn.Get([]byte("n"))
+		if err != nil {
+			return err
+		}
+		if attempts == 1 {
+			// a concurrent writer changes the key read by the transaction
+			if err := h.DB.Update(ctx, dgbadger.NewEntry([]byte("n"), []byte("5"))); err != nil {
+				return err
+			}
+		}
+		return txn.Set([]byte("n"), append(value, '0'))
+	}))
+	assert.Equal(t, 2, attempts)
+	assert.NoError(t, h.DB.View(ctx, []byte("n"), func(val []byte) error {
+		assert.Equal(t, "50", string(val))
+		return nil
+	}))
+	h.AssertSpan(t, "db.txn", badger.RetriesKey.Int(1))
+}
+
+func TestRunTxnChildSpans(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	assert.NoError(t, h.DB.RunTxn(ctx, true, func(txn *badger.Txn) error {
+		if err := txn.Set([]byte("a"), []byte("1")); err != nil {
+			return err
+		}
+		_, err := txn.Get([]byte("a"))
+		return err
+	}))
+	parent := h.AssertSpan(t, "db.txn")
+	for _, name := range []string{"db.set", "db.get"} {
+		child := h.AssertSpan(t, name)
+		assert.Equal(t, parent.SpanContext().SpanID(), child.Parent().SpanID(), name)
+		assert.Equal(t, parent.SpanContext().TraceID(), child.SpanContext().TraceID(), name)
+	}
+}
@@ -0,0 +1,224 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/XiBao/db/model"
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	VersionKey = attribute.Key("db.badger.version")
+	ReadTsKey  = attribute.Key("db.badger.read_ts")
+)
+
+// WithVersions keeps up to n versions of every key, set on NumVersionsToKeep by New.
+// Older versions are dropped by compactions, so GetAt, History and snapshots only
+// reach the versions still kept.
+func WithVersions(n int) Option {
+	return func(opt *option) {
+		opt.versions = n
+	}
+}
+
+// GetAt returns the value key had at version, model.ErrNotFound when it did not exist,
+// was deleted or expired then.
+func (t *DB) GetAt(ctx context.Context, key []byte, version uint64) (value []byte, err error) {
+	err = t.withSpan(ctx, "db.get_at", "get_at", key,
+		func(ctx context.Context) error {
+			if span := t.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(VersionKey.Int64(int64(version)))
+			}
+			return t.db.View(func(txn *badger.Txn) error {
+				kv, err := getAt(txn, key, version)
+				if err != nil {
+					return err
+				}
+				value = kv.Value
+				return nil
+			})
+		})
+	return
+}
+
+// History returns up to limit versions of key, newest first, all kept ones when limit is 0.
+func (t *DB) History(ctx context.Context, key []byte, limit int) (history []KV, err error) {
+	err = t.withSpan(ctx, "db.history", "history", key,
+		func(ctx context.Context) error {
+			return t.db.View(func(txn *badger.Txn) error {
+				stats, err := scanTxn(txn, &ScanOptions{Prefix: key, AllVersions: true}, func(kv *KV) error {
+					if !bytes.Equal(kv.Key, key) {
+						return ErrStopScan
+					}
+					history = append(history, copyKV(kv))
+					if limit > 0 && len(history) >= limit {
+						return ErrStopScan
+					}
+					return nil
+				})
+				t.recordScan(ctx, stats)
+				return err
+			})
+		})
+	return
+}
+
+// RevertKey writes back the value key had at version, or deletes key when it had none.
+func (t *DB) RevertKey(ctx context.Context, key []byte, version uint64) error {
+	return t.withSpan(ctx, "db.revert", "revert", key,
+		func(ctx context.Context) error {
+			return t.updateWithRetry(ctx, func(txn *badger.Txn) error {
+				kv, err := getAt(txn, key, version)
+				if err == model.ErrNotFound {
+					return txn.Delete(key)
+				} else if err != nil {
+					return err
+				}
+				entry := badger.NewEntry(key, kv.Value)
+				entry.ExpiresAt = kv.ExpiresAt
+				return txn.SetEntry(entry)
+			})
+		})
+}
+
+// Snapshot reads the store as it was at a read timestamp through a read transaction
+// held until Close.
+type Snapshot struct {
+	db     *DB
+	txn    *badger.Txn
+	readTs uint64
+}
+
+// NewSnapshot pins a snapshot at readTs, at the latest version when readTs is 0 or
+// later than it. The transaction held is at the latest version, it keeps compactions
+// from discarding the versions visible there but not the older ones: a snapshot at an
+// earlier readTs only sees the versions still kept, see WithVersions.
+func (t *DB) NewSnapshot(readTs uint64) *Snapshot {
+	txn := t.db.NewTransaction(false)
+	if readTs == 0 || readTs > txn.ReadTs() {
+		readTs = txn.ReadTs()
+	}
+	return &Snapshot{db: t, txn: txn, readTs: readTs}
+}
+
+func (s *Snapshot) ReadTs() uint64 {
+	return s.readTs
+}
+
+// Get returns a copy of the value of key at the read timestamp.
+func (s *Snapshot) Get(ctx context.Context, key []byte) (value []byte, err error) {
+	err = s.db.withSpan(ctx, "db.snapshot.get", "get", key,
+		func(ctx context.Context) error {
+			if span := s.db.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(ReadTsKey.Int64(int64(s.readTs)))
+			}
+			kv, err := getAt(s.txn, key, s.readTs)
+			if err != nil {
+				return err
+			}
+			value = kv.Value
+			return nil
+		})
+	return
+}
+
+// Scan is DB.Scan at the read timestamp, AllVersions is ignored.
+func (s *Snapshot) Scan(ctx context.Context, opts *ScanOptions, fn func(kv *KV) error) error {
+	if opts == nil {
+		opts = new(ScanOptions)
+	}
+	return s.db.withSpan(ctx, "db.snapshot.scan", "scan", opts.spanKey(),
+		func(ctx context.Context) error {
+			if span := s.db.span(ctx); span != nil && span.IsRecording() {
+				span.SetAttributes(ReadTsKey.Int64(int64(s.readTs)))
+			}
+			all := *opts
+			all.AllVersions = true
+			all.Limit = 0
+			var (
+				candidate *KV
+				count     int
+				stopped   bool
+			)
+			// versions come newest first, oldest first when reversed, the visible one is
+			// the newest not after the read timestamp
+			emit := func() error {
+				kv := candidate
+				candidate = nil
+				if kv == nil || kv.Deleted {
+					return nil
+				}
+				if err := fn(kv); err != nil {
+					return err
+				}
+				if count++; opts.Limit > 0 && count >= opts.Limit {
+					stopped = true
+					return ErrStopScan
+				}
+				return nil
+			}
+			stats, err := scanTxn(s.txn, &all, func(kv *KV) error {
+				if candidate != nil && !bytes.Equal(candidate.Key, kv.Key) {
+					if err := emit(); err != nil {
+						return err
+					}
+				}
+				if kv.Version > s.readTs {
+					return nil
+				}
+				if candidate == nil || opts.Reverse {
+					visible := copyKV(kv)
+					candidate = &visible
+				}
+				return nil
+			})
+			if err == nil && !stopped {
+				err = emit()
+			}
+			s.db.recordScan(ctx, stats)
+			if err == ErrStopScan {
+				err = nil
+			}
+			return err
+		})
+}
+
+// Close releases the read transaction.
+func (s *Snapshot) Close() {
+	s.txn.Discard()
+}
+
+// getAt returns the newest version of key not after version, with a copy of its value.
+func getAt(txn *badger.Txn, key []byte, version uint64) (*KV, error) {
+	var found *KV
+	_, err := scanTxn(txn, &ScanOptions{Prefix: key, AllVersions: true}, func(kv *KV) error {
+		if !bytes.Equal(kv.Key, key) {
+			return ErrStopScan
+		}
+		if kv.Version > version {
+			return nil
+		}
+		visible := copyKV(kv)
+		found = &visible
+		return ErrStopScan
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil || found.Deleted {
+		return nil, model.ErrNotFound
+	}
+	return found, nil
+}
+
+func copyKV(kv *KV) KV {
+	return KV{
+		Key:       append([]byte(nil), kv.Key...),
+		Value:     append([]byte(nil), kv.Value...),
+		Version:   kv.Version,
+		ExpiresAt: kv.ExpiresAt,
+		Deleted:   kv.Deleted,
+	}
+}
@@ -0,0 +1,178 @@
+package badger_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	"github.com/XiBao/db/model"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// versionedStore writes two versions of a small key set and returns the read timestamps
+// after each: a, ab, b and c at 1, then a at 2, b deleted and d at 2.
+func versionedStore(t *testing.T) (h *badgertest.Harness, v1 uint64, v2 uint64) {
+	ctx := context.Background()
+	h = badgertest.New(t, badger.WithVersions(10))
+	set := func(key string, value string) {
+		assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte(key), []byte(value))))
+	}
+	readTs := func() uint64 {
+		snapshot := h.DB.NewSnapshot(0)
+		defer snapshot.Close()
+		return snapshot.ReadTs()
+	}
+	for _, key := range []string{"a", "ab", "b", "c"} {
+		set(key, "1")
+	}
+	v1 = readTs()
+	set("a", "2")
+	assert.NoError(t, h.DB.Delete(ctx, []byte("b")))
+	set("d", "2")
+	v2 = readTs()
+	return h, v1, v2
+}
+
+func TestGetAt(t *testing.T) {
+	ctx := context.Background()
+	h, v1, v2 := versionedStore(t)
+	for _, tt := range []struct {
+		key     string
+		version uint64
+		want    string
+	}{
+		{"a", v1, "1"},
+		{"a", v2, "2"},
+		{"a", math.MaxUint64, "2"},
+		{"b", v1, "1"},
+		{"b", v2, ""},
+		{"d", v1, ""},
+		{"a", 0, ""},
+	} {
+		value, err := h.DB.GetAt(ctx, []byte(tt.key), tt.version)
+		if tt.want == "" {
+			assert.ErrorIs(t, err, model.ErrNotFound, "%s at %d", tt.key, tt.version)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, string(value), "%s at %d", tt.key, tt.version)
+	}
+	h.AssertSpan(t, "db.get_at", badger.VersionKey.Int64(int64(v1)))
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	h, v1, _ := versionedStore(t)
+
+	// ab shares the prefix of a but is another key
+	history, err := h.DB.History(ctx, []byte("a"), 0)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "2", string(history[0].Value))
+		assert.Equal(t, "1", string(history[1].Value))
+		assert.Greater(t, history[0].Version, v1)
+		assert.LessOrEqual(t, history[1].Version, v1)
+	}
+
+	history, err = h.DB.History(ctx, []byte("a"), 1)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "2", string(history[0].Value))
+	}
+
+	history, err = h.DB.History(ctx, []byte("b"), 0)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.True(t, history[0].Deleted)
+		assert.False(t, history[1].Deleted)
+	}
+
+	history, err = h.DB.History(ctx, []byte("missing"), 0)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestRevertKey(t *testing.T) {
+	ctx := context.Background()
+	h, v1, _ := versionedStore(t)
+	get := func(key string) string {
+		value, err := h.DB.GetAt(ctx, []byte(key), math.MaxUint64)
+		if err == model.ErrNotFound {
+			return "<none>"
+		}
+		assert.NoError(t, err)
+		return string(value)
+	}
+
+	assert.NoError(t, h.DB.RevertKey(ctx, []byte("a"), v1))
+	assert.Equal(t, "1", get("a"))
+	// deleted since v1
+	assert.NoError(t, h.DB.RevertKey(ctx, []byte("b"), v1))
+	assert.Equal(t, "1", get("b"))
+	// created since v1
+	assert.NoError(t, h.DB.RevertKey(ctx, []byte("d"), v1))
+	assert.Equal(t, "<none>", get("d"))
+	assert.Equal(t, "1", get("ab"))
+
+	// a revert is a new version, the reverted one stays in the history
+	history, err := h.DB.History(ctx, []byte("a"), 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 3)
+	h.AssertSpan(t, "db.revert")
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	h, v1, v2 := versionedStore(t)
+	scan := func(snapshot *badger.Snapshot, opts *badger.ScanOptions) []string {
+		kvs := []string{}
+		assert.NoError(t, snapshot.Scan(ctx, opts, func(kv *badger.KV) error {
+			kvs = append(kvs, string(kv.Key)+"="+string(kv.Value))
+			return nil
+		}))
+		return kvs
+	}
+
+	old := h.DB.NewSnapshot(v1)
+	defer old.Close()
+	latest := h.DB.NewSnapshot(0)
+	defer latest.Close()
+	assert.Equal(t, v1, old.ReadTs())
+	assert.Equal(t, v2, latest.ReadTs())
+	// written after both snapshots
+	assert.NoError(t, h.DB.Update(ctx, dgbadger.NewEntry([]byte("a"), []byte("3"))))
+
+	for _, tt := range []struct {
+		name     string
+		snapshot *badger.Snapshot
+		opts     *badger.ScanOptions
+		want     []string
+	}{
+		{"old", old, nil, []string{"a=1", "ab=1", "b=1", "c=1"}},
+		{"old reverse", old, &badger.ScanOptions{Reverse: true}, []string{"c=1", "b=1", "ab=1", "a=1"}},
+		{"old reverse limit", old, &badger.ScanOptions{Reverse: true, Limit: 2}, []string{"c=1", "b=1"}},
+		{"old prefix", old, &badger.ScanOptions{Prefix: []byte("a"), Reverse: true}, []string{"ab=1", "a=1"}},
+		{"latest", latest, nil, []string{"a=2", "ab=1", "c=1", "d=2"}},
+		{"latest reverse", latest, &badger.ScanOptions{Reverse: true}, []string{"d=2", "c=1", "ab=1", "a=2"}},
+		{"latest limit", latest, &badger.ScanOptions{Limit: 1}, []string{"a=2"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, scan(tt.snapshot, tt.opts))
+		})
+	}
+
+	value, err := old.Get(ctx, []byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(value))
+	_, err = latest.Get(ctx, []byte("b"))
+	assert.ErrorIs(t, err, model.ErrNotFound)
+	h.AssertSpan(t, "db.snapshot.scan", badger.ReadTsKey.Int64(int64(v1)))
+
+	// a later read timestamp is clamped to the latest version
+	future := h.DB.NewSnapshot(math.MaxUint64)
+	defer future.Close()
+	assert.Greater(t, future.ReadTs(), v2)
+}
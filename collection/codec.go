@@ -0,0 +1,158 @@
+package collection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrCodec matches every CodecError with errors.Is.
+var ErrCodec = errors.New("codec error")
+
+// CodecError is returned when a key or a value can not be encoded or decoded, storage
+// errors are returned as is.
+type CodecError struct {
+	// Op is "encode" or "decode".
+	Op string
+	// Target is "key" or "value".
+	Target string
+	Err    error
+}
+
+func (e *CodecError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Target, e.Err)
+}
+
+func (e *CodecError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CodecError) Is(target error) bool {
+	return target == ErrCodec
+}
+
+// Codec converts T to and from its stored bytes. Key codecs should keep the order of
+// the keys for Scan to return them in order.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSON encodes with encoding/json.
+type JSON[T any] struct{}
+
+func (JSON[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSON[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// Gob encodes with encoding/gob, every value carries its type description.
+type Gob[T any] struct{}
+
+func (Gob[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (Gob[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// Msgpack encodes with github.com/vmihailenco/msgpack.
+type Msgpack[T any] struct{}
+
+func (Msgpack[T]) Encode(v T) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (Msgpack[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := msgpack.Unmarshal(data, &v)
+	return v, err
+}
+
+// Proto encodes generated protobuf messages, T is the message pointer type.
+type Proto[T proto.Message] struct{}
+
+func (Proto[T]) Encode(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (Proto[T]) Decode(data []byte) (T, error) {
+	var zero T
+	v, ok := zero.ProtoReflect().Type().New().Interface().(T)
+	if !ok {
+		return zero, fmt.Errorf("can not create %T", zero)
+	}
+	if err := proto.Unmarshal(data, v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// Raw stores byte slices as is, decoded values are copies.
+type Raw struct{}
+
+func (Raw) Encode(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (Raw) Decode(data []byte) ([]byte, error) {
+	return append([]byte(nil), data...), nil
+}
+
+// String stores strings as their bytes.
+type String struct{}
+
+func (String) Encode(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+func (String) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// Uint64 stores integers big endian, so their byte order is their numeric order.
+type Uint64 struct{}
+
+func (Uint64) Encode(v uint64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, v), nil
+}
+
+func (Uint64) Decode(data []byte) (uint64, error) {
+	if len(data) != 8 {
+		return 0, fmt.Errorf("uint64 needs 8 bytes, got %d", len(data))
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// Int64 stores integers big endian with the sign bit flipped, so their byte order
+// is their numeric order.
+type Int64 struct{}
+
+func (Int64) Encode(v int64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, uint64(v)^(1<<63)), nil
+}
+
+func (Int64) Decode(data []byte) (int64, error) {
+	if len(data) != 8 {
+		return 0, fmt.Errorf("int64 needs 8 bytes, got %d", len(data))
+	}
+	return int64(binary.BigEndian.Uint64(data) ^ (1 << 63)), nil
+}
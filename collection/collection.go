@@ -0,0 +1,186 @@
+// Package collection provides typed collections over badger.DB, nutsdb.Table or files
+// shared by the processes of a host.
+package collection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidName is returned by New and AddIndex for an empty name or one containing ':',
+// which ends the collection prefix, or '#', which separates a collection from its indexes.
+var ErrInvalidName = errors.New("collection: invalid name")
+
+// Collection stores values V under keys K encoded by codecs, prefixed by the
+// collection name so that collections can share a store.
+type Collection[K any, V any] struct {
+	store   Store
+	name    string
+	prefix  []byte
+	keys    Codec[K]
+	values  Codec[V]
+	indexes []*Index[K, V]
+}
+
+// New returns a collection named name, ErrInvalidName when name is empty or
+// contains ':' or '#'.
+func New[K any, V any](store Store, name string, keys Codec[K], values Codec[V]) (*Collection[K, V], error) {
+	if err := validName("collection", name); err != nil {
+		return nil, err
+	}
+	return &Collection[K, V]{
+		store:  store,
+		name:   name,
+		prefix: []byte(name + ":"),
+		keys:   keys,
+		values: values,
+	}, nil
+}
+
+func (c *Collection[K, V]) Name() string {
+	return c.name
+}
+
+func (c *Collection[K, V]) Store() Store {
+	return c.store
+}
+
+// Get returns the value of key, model.ErrNotFound when it is missing.
+func (c *Collection[K, V]) Get(ctx context.Context, key K) (value V, err error) {
+	err = c.store.View(ctx, func(tx Tx) error {
+		value, err = c.GetTx(tx, key)
+		return err
+	})
+	return
+}
+
+func (c *Collection[K, V]) Set(ctx context.Context, key K, value V) error {
+	return c.store.Update(ctx, func(tx Tx) error {
+		return c.SetTx(tx, key, value)
+	})
+}
+
+// SetWithTTL writes value expiring after ttl along with its index entries, without
+// expiry when ttl is 0, see Tx.
+func (c *Collection[K, V]) SetWithTTL(ctx context.Context, key K, value V, ttl time.Duration) error {
+	return c.store.Update(ctx, func(tx Tx) error {
+		return c.SetWithTTLTx(tx, key, value, ttl)
+	})
+}
+
+func (c *Collection[K, V]) Delete(ctx context.Context, key K) error {
+	return c.store.Update(ctx, func(tx Tx) error {
+		return c.DeleteTx(tx, key)
+	})
+}
+
+// Scan calls fn for every item of the collection in the order of the encoded keys.
+func (c *Collection[K, V]) Scan(ctx context.Context, fn func(key K, value V) error) error {
+	return c.store.View(ctx, func(tx Tx) error {
+		return c.ScanTx(tx, nil, fn)
+	})
+}
+
+// ScanPrefix calls fn for the items whose encoded key starts with prefix.
+func (c *Collection[K, V]) ScanPrefix(ctx context.Context, prefix []byte, fn func(key K, value V) error) error {
+	return c.store.View(ctx, func(tx Tx) error {
+		return c.ScanTx(tx, prefix, fn)
+	})
+}
+
+// GetTx is Get within tx, so that several collections can be used in one transaction.
+func (c *Collection[K, V]) GetTx(tx Tx, key K) (value V, err error) {
+	k, err := c.encodeKey(key)
+	if err != nil {
+		return value, err
+	}
+	data, err := tx.Get(k)
+	if err != nil {
+		return value, err
+	}
+	return c.decodeValue(data)
+}
+
+func (c *Collection[K, V]) SetTx(tx Tx, key K, value V) error {
+	return c.setTx(tx, key, value, tx.Set)
+}
+
+func (c *Collection[K, V]) SetWithTTLTx(tx Tx, key K, value V, ttl time.Duration) error {
+	if ttl < 0 {
+		return ErrNegativeTTL
+	}
+	return c.setTx(tx, key, value, func(key []byte, value []byte) error {
+		return tx.SetWithTTL(key, value, ttl)
+	})
+}
+
+// setTx writes value and its index entries with set.
+func (c *Collection[K, V]) setTx(tx Tx, key K, value V, set func(key []byte, value []byte) error) error {
+	k, err := c.encodeKey(key)
+	if err != nil {
+		return err
+	}
+	v, err := c.values.Encode(value)
+	if err != nil {
+		return &CodecError{Op: "encode", Target: "value", Err: err}
+	}
+	if err := c.updateIndexes(tx, k, &value, set); err != nil {
+		return err
+	}
+	return set(k, v)
+}
+
+func (c *Collection[K, V]) DeleteTx(tx Tx, key K) error {
+	k, err := c.encodeKey(key)
+	if err != nil {
+		return err
+	}
+	if err := c.updateIndexes(tx, k, nil, tx.Set); err != nil {
+		return err
+	}
+	return tx.Delete(k)
+}
+
+func (c *Collection[K, V]) ScanTx(tx Tx, prefix []byte, fn func(key K, value V) error) error {
+	return tx.Scan(c.rawKey(prefix), func(k []byte, v []byte) error {
+		key, err := c.keys.Decode(k[len(c.prefix):])
+		if err != nil {
+			return &CodecError{Op: "decode", Target: "key", Err: err}
+		}
+		value, err := c.decodeValue(v)
+		if err != nil {
+			return err
+		}
+		return fn(key, value)
+	})
+}
+
+func (c *Collection[K, V]) encodeKey(key K) ([]byte, error) {
+	k, err := c.keys.Encode(key)
+	if err != nil {
+		return nil, &CodecError{Op: "encode", Target: "key", Err: err}
+	}
+	return c.rawKey(k), nil
+}
+
+func (c *Collection[K, V]) rawKey(k []byte) []byte {
+	return append(append(make([]byte, 0, len(c.prefix)+len(k)), c.prefix...), k...)
+}
+
+func (c *Collection[K, V]) decodeValue(data []byte) (V, error) {
+	value, err := c.values.Decode(data)
+	if err != nil {
+		return value, &CodecError{Op: "decode", Target: "value", Err: err}
+	}
+	return value, nil
+}
+
+func validName(kind string, name string) error {
+	if name == "" || strings.ContainsAny(name, ":#") {
+		return fmt.Errorf("%w: %s name %q", ErrInvalidName, kind, name)
+	}
+	return nil
+}
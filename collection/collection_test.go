@@ -0,0 +1,360 @@
+package collection_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dgbadger "github.com/dgraph-io/badger/v4"
+	nuts "github.com/nutsdb/nutsdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/collection"
+	"github.com/XiBao/db/model"
+	"github.com/XiBao/db/nutsdb"
+)
+
+type user struct {
+	Name  string
+	Email string
+}
+
+func stores(t *testing.T) map[string]collection.Store {
+	ctx := context.Background()
+	bdb, err := badger.New(ctx, dgbadger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bdb.Close(ctx) })
+
+	ndb, err := nuts.Open(nuts.DefaultOptions, nuts.WithDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ndb.Close() })
+	table, err := nutsdb.NewTable(ndb, "test", nuts.Persistent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := collection.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]collection.Store{
+		"badger": collection.NewBadgerStore(bdb),
+		"nutsdb": collection.NewNutsStore(table),
+		"file":   file,
+	}
+}
+
+func TestCollection(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			users, err := collection.New(store, "user", collection.Uint64{}, collection.JSON[user]{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NoError(t, users.Set(ctx, 2, user{Name: "b"}))
+			assert.NoError(t, users.Set(ctx, 1, user{Name: "a"}))
+
+			u, err := users.Get(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, "a", u.Name)
+
+			var keys []uint64
+			assert.NoError(t, users.Scan(ctx, func(key uint64, value user) error {
+				keys = append(keys, key)
+				return nil
+			}))
+			assert.Equal(t, []uint64{1, 2}, keys)
+
+			assert.NoError(t, users.Delete(ctx, 1))
+			_, err = users.Get(ctx, 1)
+			assert.ErrorIs(t, err, model.ErrNotFound)
+
+			raw, err := collection.New(store, "user", collection.Uint64{}, collection.Raw{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NoError(t, raw.Set(ctx, 3, []byte("{")))
+			_, err = users.Get(ctx, 3)
+			assert.ErrorIs(t, err, collection.ErrCodec)
+			var codecErr *collection.CodecError
+			assert.True(t, errors.As(err, &codecErr))
+			assert.Equal(t, "decode", codecErr.Op)
+			assert.Equal(t, "value", codecErr.Target)
+		})
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	for _, v := range []int64{-5, 0, 7} {
+		data, err := collection.Int64{}.Encode(v)
+		assert.NoError(t, err)
+		got, err := collection.Int64{}.Decode(data)
+		assert.NoError(t, err)
+		assert.Equal(t, v, got)
+	}
+	neg, _ := collection.Int64{}.Encode(-1)
+	pos, _ := collection.Int64{}.Encode(1)
+	assert.Less(t, string(neg), string(pos))
+
+	in := user{Name: "a", Email: "a@b.c"}
+	for name, codec := range map[string]collection.Codec[user]{
+		"json":    collection.JSON[user]{},
+		"gob":     collection.Gob[user]{},
+		"msgpack": collection.Msgpack[user]{},
+	} {
+		data, err := codec.Encode(in)
+		assert.NoError(t, err, name)
+		out, err := codec.Decode(data)
+		assert.NoError(t, err, name)
+		assert.Equal(t, in, out, name)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			users, err := collection.New(store, "user", collection.Uint64{}, collection.JSON[user]{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NoError(t, users.Set(ctx, 1, user{Name: "a", Email: "a@x.com"}))
+
+			byEmail, err := users.AddIndex("email", func(u user) [][]byte {
+				return [][]byte{[]byte(u.Email)}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys, err := byEmail.Keys(ctx, []byte("a@x.com"))
+			assert.NoError(t, err)
+			assert.Empty(t, keys)
+
+			n, err := byEmail.Rebuild(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+
+			assert.NoError(t, users.Set(ctx, 2, user{Name: "b", Email: "b@x.com"}))
+			assert.NoError(t, users.Set(ctx, 1, user{Name: "a", Email: "a@y.com"}))
+
+			keys, err = byEmail.Keys(ctx, []byte("a@x.com"))
+			assert.NoError(t, err)
+			assert.Empty(t, keys)
+			keys, err = byEmail.Keys(ctx, []byte("a@y.com"))
+			assert.NoError(t, err)
+			assert.Equal(t, []uint64{1}, keys)
+
+			var names []string
+			assert.NoError(t, byEmail.ScanPrefix(ctx, []byte("b@"), func(key uint64, value user) error {
+				names = append(names, value.Name)
+				return nil
+			}))
+			assert.Equal(t, []string{"b"}, names)
+
+			assert.NoError(t, users.Delete(ctx, 2))
+			keys, err = byEmail.Keys(ctx, []byte("b@x.com"))
+			assert.NoError(t, err)
+			assert.Empty(t, keys)
+
+			entries, err := users.RebuildIndexes(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]int{"email": 1}, entries)
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	store := stores(t)["badger"]
+	for _, name := range []string{"", "user#email", "user:1"} {
+		_, err := collection.New(store, name, collection.Uint64{}, collection.Raw{})
+		assert.ErrorIs(t, err, collection.ErrInvalidName, name)
+	}
+	users, err := collection.New(store, "user", collection.Uint64{}, collection.Raw{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, name := range []string{"", "email#domain", "email:domain"} {
+		_, err := users.AddIndex(name, func(value []byte) [][]byte { return nil })
+		assert.ErrorIs(t, err, collection.ErrInvalidName, name)
+	}
+}
+
+func TestScanPrefix(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			users, err := collection.New(store, "user", collection.String{}, collection.Raw{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a collection whose name starts with the other one's
+			usersOld, err := collection.New(store, "user_old", collection.String{}, collection.Raw{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"b1", "a2", "a1"} {
+				assert.NoError(t, users.Set(ctx, key, []byte("v"+key)))
+			}
+			assert.NoError(t, usersOld.Set(ctx, "a3", []byte("old")))
+
+			var keys, values []string
+			assert.NoError(t, users.ScanPrefix(ctx, []byte("a"), func(key string, value []byte) error {
+				keys = append(keys, key)
+				values = append(values, string(value))
+				return nil
+			}))
+			assert.Equal(t, []string{"a1", "a2"}, keys)
+			assert.Equal(t, []string{"va1", "va2"}, values)
+
+			keys = nil
+			assert.NoError(t, users.Scan(ctx, func(key string, value []byte) error {
+				keys = append(keys, key)
+				return collection.ErrStopScan
+			}))
+			assert.Equal(t, []string{"a1"}, keys)
+
+			keys = nil
+			assert.NoError(t, users.ScanPrefix(ctx, []byte("c"), func(key string, value []byte) error {
+				keys = append(keys, key)
+				return nil
+			}))
+			assert.Empty(t, keys)
+		})
+	}
+}
+
+func TestRunRebuildCommand(t *testing.T) {
+	ctx := context.Background()
+	store := stores(t)["badger"]
+	users, err := collection.New(store, "user", collection.Uint64{}, collection.JSON[user]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, err := collection.New(store, "order", collection.Uint64{}, collection.Raw{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, users.Set(ctx, 1, user{Name: "a", Email: "a@x.com"}))
+	assert.NoError(t, orders.Set(ctx, 1, []byte("o1")))
+	if _, err := users.AddIndex("email", func(u user) [][]byte { return [][]byte{[]byte(u.Email)} }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orders.AddIndex("value", func(v []byte) [][]byte { return [][]byte{v} }); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	assert.NoError(t, collection.RunRebuildCommand(ctx, nil, &out, users, orders))
+	assert.Equal(t, "user.email: 1 entries\norder.value: 1 entries\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, collection.RunRebuildCommand(ctx, []string{"-collection", "order"}, &out, users, orders))
+	assert.Equal(t, "order.value: 1 entries\n", out.String())
+
+	err = collection.RunRebuildCommand(ctx, []string{"-collection", "invoice"}, &out, users, orders)
+	assert.ErrorIs(t, err, collection.ErrUnknownCollection)
+	assert.Error(t, collection.RunRebuildCommand(ctx, []string{"user"}, &out, users, orders))
+}
+
+func TestSetWithTTL(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			users, err := collection.New(store, "user", collection.Uint64{}, collection.JSON[user]{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			byEmail, err := users.AddIndex("email", func(u user) [][]byte { return [][]byte{[]byte(u.Email)} })
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NoError(t, users.SetWithTTL(ctx, 1, user{Name: "a", Email: "a@x.com"}, time.Hour))
+			assert.NoError(t, users.SetWithTTL(ctx, 2, user{Name: "b", Email: "b@x.com"}, 0))
+			assert.ErrorIs(t, users.SetWithTTL(ctx, 3, user{Name: "c"}, -time.Second), collection.ErrNegativeTTL)
+
+			u, err := users.Get(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, "a", u.Name)
+			keys, err := byEmail.Keys(ctx, []byte("a@x.com"))
+			assert.NoError(t, err)
+			assert.Equal(t, []uint64{1}, keys)
+			_, err = users.Get(ctx, 3)
+			assert.ErrorIs(t, err, model.ErrNotFound)
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	// two stores of one dir stand for two processes
+	a, err := collection.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := collection.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters, err := collection.New(a, "counter", collection.String{}, collection.JSON[int]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := collection.New(b, "counter", collection.String{}, collection.JSON[int]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// increments of both stores exclude each other
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := counters
+			if i%2 == 1 {
+				c = other
+			}
+			assert.NoError(t, c.Store().Update(ctx, func(tx collection.Tx) error {
+				n, err := c.GetTx(tx, "n")
+				if err != nil && !errors.Is(err, model.ErrNotFound) {
+					return err
+				}
+				return c.SetTx(tx, "n", n+1)
+			}))
+		}()
+	}
+	wg.Wait()
+	n, err := other.Get(ctx, "n")
+	assert.NoError(t, err)
+	assert.Equal(t, 20, n)
+
+	assert.NoError(t, counters.SetWithTTL(ctx, "short", 1, 10*time.Millisecond))
+	_, err = other.Get(ctx, "short")
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = other.Get(ctx, "short")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	assert.Error(t, a.View(ctx, func(tx collection.Tx) error {
+		return tx.Set([]byte("k"), []byte("v"))
+	}))
+	errFailed := errors.New("failed")
+	assert.ErrorIs(t, a.Update(ctx, func(tx collection.Tx) error {
+		if err := counters.SetTx(tx, "n", 0); err != nil {
+			return err
+		}
+		return errFailed
+	}), errFailed)
+	n, err = other.Get(ctx, "n")
+	assert.NoError(t, err)
+	assert.Equal(t, 20, n, "rolled back")
+}
@@ -0,0 +1,73 @@
+package collection
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+)
+
+// RebuildCommandName is the usual name of the command run by RunRebuildCommand.
+const RebuildCommandName = "rebuild-indexes"
+
+// ErrUnknownCollection is returned by RunRebuildCommand for a -collection not passed to it.
+var ErrUnknownCollection = errors.New("collection: unknown collection")
+
+// Rebuilder is a collection with indexes, every *Collection is one.
+type Rebuilder interface {
+	Name() string
+	RebuildIndexes(ctx context.Context) (map[string]int, error)
+}
+
+// RunRebuildCommand runs the index rebuild command over collections:
+//
+//	rebuild-indexes [-collection name]...
+//
+// args are the arguments following the command name. Without -collection every collection
+// is rebuilt. One line "<collection>.<index>: <entries> entries" is written to out per
+// index. Index functions are Go code of the application, which declares its collections
+// as usual and calls RunRebuildCommand from its main, e.g. for a rebuild-indexes argument.
+func RunRebuildCommand(ctx context.Context, args []string, out io.Writer, collections ...Rebuilder) error {
+	var names []string
+	flags := flag.NewFlagSet(RebuildCommandName, flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Func("collection", "rebuild the indexes of this collection only, can be repeated", func(name string) error {
+		names = append(names, name)
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("collection: unexpected arguments %q", flags.Args())
+	}
+	selected := collections
+	if len(names) > 0 {
+		selected = make([]Rebuilder, 0, len(names))
+		for _, name := range names {
+			idx := slices.IndexFunc(collections, func(c Rebuilder) bool { return c.Name() == name })
+			if idx < 0 {
+				return fmt.Errorf("%w: %s", ErrUnknownCollection, name)
+			}
+			selected = append(selected, collections[idx])
+		}
+	}
+	for _, c := range selected {
+		entries, err := c.RebuildIndexes(ctx)
+		if err != nil {
+			return err
+		}
+		indexes := make([]string, 0, len(entries))
+		for name := range entries {
+			indexes = append(indexes, name)
+		}
+		sort.Strings(indexes)
+		for _, name := range indexes {
+			fmt.Fprintf(out, "%s.%s: %d entries\n", c.Name(), name, entries[name])
+		}
+	}
+	return nil
+}
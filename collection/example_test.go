@@ -0,0 +1,74 @@
+package collection_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	dgbadger "github.com/dgraph-io/badger/v4"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/collection"
+)
+
+func ExampleCollection_RebuildIndexes() {
+	ctx := context.Background()
+	db, err := badger.New(ctx, dgbadger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close(ctx)
+	users, err := collection.New(collection.NewBadgerStore(db), "user", collection.Uint64{}, collection.JSON[user]{})
+	if err != nil {
+		panic(err)
+	}
+	// written before the index existed
+	users.Set(ctx, 1, user{Name: "a", Email: "a@x.com"})
+	if _, err := users.AddIndex("email", func(u user) [][]byte {
+		return [][]byte{[]byte(u.Email)}
+	}); err != nil {
+		panic(err)
+	}
+
+	entries, err := users.RebuildIndexes(ctx)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(entries)
+	// Output: map[email:1]
+}
+
+// The index functions live in the application, which runs the rebuild command from its
+// main, e.g. "app rebuild-indexes -collection user" with os.Args[2:] as args.
+func ExampleRunRebuildCommand() {
+	ctx := context.Background()
+	db, err := badger.New(ctx, dgbadger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close(ctx)
+	users, err := collection.New(collection.NewBadgerStore(db), "user", collection.Uint64{}, collection.JSON[user]{})
+	if err != nil {
+		panic(err)
+	}
+	users.Set(ctx, 1, user{Name: "a", Email: "a@x.com"})
+	users.Set(ctx, 2, user{Name: "b", Email: "b@x.com"})
+	if _, err := users.AddIndex("email", func(u user) [][]byte {
+		return [][]byte{[]byte(u.Email)}
+	}); err != nil {
+		panic(err)
+	}
+	if _, err := users.AddIndex("name", func(u user) [][]byte {
+		return [][]byte{[]byte(u.Name)}
+	}); err != nil {
+		panic(err)
+	}
+
+	args := []string{"-collection", "user"}
+	if err := collection.RunRebuildCommand(ctx, args, os.Stdout, users); err != nil {
+		panic(err)
+	}
+	// Output:
+	// user.email: 2 entries
+	// user.name: 2 entries
+}
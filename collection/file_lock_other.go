@@ -0,0 +1,15 @@
+//go:build !unix || aix || solaris
+
+package collection
+
+import "os"
+
+const fileLockSupported = false
+
+func lockFile(f *os.File, exclusive bool) error {
+	return ErrFileStoreUnsupported
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
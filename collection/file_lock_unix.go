@@ -0,0 +1,30 @@
+//go:build unix && !aix && !solaris
+
+package collection
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const fileLockSupported = true
+
+// lockFile waits for a flock of f, exclusive or shared. The locks are held per open
+// file, so that they also exclude the goroutines of one process opening f each.
+func lockFile(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
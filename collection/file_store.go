@@ -0,0 +1,212 @@
+package collection
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/XiBao/db/model"
+)
+
+const (
+	fileStoreLock = "lock"
+	fileStoreData = "data.json"
+)
+
+// ErrFileStoreUnsupported is returned by NewFileStore on platforms without flock.
+var ErrFileStoreUnsupported = errors.New("collection: file store not supported on this platform")
+
+var errReadOnlyTx = errors.New("collection: write in a read-only transaction")
+
+type fileStore struct {
+	dir string
+	now func() time.Time
+}
+
+// NewFileStore keeps the collections in one file of dir, shared by the processes of a
+// host opening the same dir, unlike badger and nutsdb which lock their directory to one
+// process. Every transaction holds a flock of dir, shared by View and exclusive by
+// Update, reads the whole file and Update writes it again before releasing the lock, so
+// it suits small collections such as the leases of a few processes. The lock is waited
+// for whatever ctx. Platforms without flock, e.g. Windows, return ErrFileStoreUnsupported.
+func NewFileStore(dir string) (Store, error) {
+	if !fileLockSupported {
+		return nil, ErrFileStoreUnsupported
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir, now: time.Now}, nil
+}
+
+func (s *fileStore) View(ctx context.Context, fn func(tx Tx) error) error {
+	return s.run(ctx, false, fn)
+}
+
+func (s *fileStore) Update(ctx context.Context, fn func(tx Tx) error) error {
+	return s.run(ctx, true, fn)
+}
+
+func (s *fileStore) run(ctx context.Context, update bool, fn func(tx Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(filepath.Join(s.dir, fileStoreLock), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock, update); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	tx := &fileTx{update: update, now: s.now().UnixNano(), entries: make(map[string]fileEntry)}
+	if err := s.load(tx); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if !tx.dirty {
+		return nil
+	}
+	return s.save(tx)
+}
+
+type fileEntry struct {
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+func (e *fileEntry) expired(now int64) bool {
+	return e.ExpiresAt != 0 && now >= e.ExpiresAt
+}
+
+// load reads the entries not expired, an Update drops the expired ones from the file.
+func (s *fileStore) load(tx *fileTx) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, fileStoreData))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var entries []fileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.expired(tx.now) {
+			tx.dirty = tx.update
+			continue
+		}
+		tx.entries[string(entry.Key)] = entry
+	}
+	return nil
+}
+
+// save replaces the file by a new one, readers never see it half written.
+func (s *fileStore) save(tx *fileTx) error {
+	data, err := json.Marshal(tx.sorted(nil))
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, fileStoreData+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, fileStoreData))
+}
+
+type fileTx struct {
+	update  bool
+	dirty   bool
+	now     int64
+	entries map[string]fileEntry
+}
+
+func (x *fileTx) Get(key []byte) ([]byte, error) {
+	entry, ok := x.entries[string(key)]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	return entry.Value, nil
+}
+
+func (x *fileTx) Set(key []byte, value []byte) error {
+	return x.SetWithTTL(key, value, 0)
+}
+
+func (x *fileTx) SetWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if !x.update {
+		return errReadOnlyTx
+	}
+	if ttl < 0 {
+		return ErrNegativeTTL
+	}
+	entry := fileEntry{
+		Key:   append([]byte(nil), key...),
+		Value: append([]byte(nil), value...),
+	}
+	if ttl > 0 {
+		entry.ExpiresAt = x.now + int64(ttl)
+	}
+	x.entries[string(key)] = entry
+	x.dirty = true
+	return nil
+}
+
+func (x *fileTx) Delete(key []byte) error {
+	if !x.update {
+		return errReadOnlyTx
+	}
+	if _, ok := x.entries[string(key)]; ok {
+		delete(x.entries, string(key))
+		x.dirty = true
+	}
+	return nil
+}
+
+func (x *fileTx) Scan(prefix []byte, fn func(key []byte, value []byte) error) error {
+	for _, entry := range x.sorted(prefix) {
+		if err := fn(entry.Key, entry.Value); err != nil {
+			if errors.Is(err, ErrStopScan) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// sorted returns the entries whose key starts with prefix in key order.
+func (x *fileTx) sorted(prefix []byte) []fileEntry {
+	entries := make([]fileEntry, 0, len(x.entries))
+	for _, entry := range x.entries {
+		if bytes.HasPrefix(entry.Key, prefix) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Key, entries[j].Key) < 0
+	})
+	return entries
+}
@@ -0,0 +1,254 @@
+package collection
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/XiBao/db/model"
+)
+
+const rebuildBatchSize = 1000
+
+// IndexFunc returns the index values of a value, none when it is not indexed.
+type IndexFunc[V any] func(value V) [][]byte
+
+// Index is a secondary index of a Collection. Its entries are written in the transaction
+// of the primary write or delete, stored as <collection>#<index>:<index value>\x00<key>.
+type Index[K any, V any] struct {
+	collection *Collection[K, V]
+	name       string
+	prefix     []byte
+	fn         IndexFunc[V]
+}
+
+// AddIndex declares an index of the collection computed by fn. Indexes must be added
+// before the collection is used, Rebuild indexes the items written before. Like New it
+// returns ErrInvalidName for an empty name or one containing ':' or '#'.
+func (c *Collection[K, V]) AddIndex(name string, fn IndexFunc[V]) (*Index[K, V], error) {
+	if err := validName("index", name); err != nil {
+		return nil, err
+	}
+	idx := &Index[K, V]{
+		collection: c,
+		name:       name,
+		prefix:     []byte(c.name + "#" + name + ":"),
+		fn:         fn,
+	}
+	c.indexes = append(c.indexes, idx)
+	return idx, nil
+}
+
+func (idx *Index[K, V]) Name() string {
+	return idx.name
+}
+
+// Keys returns the keys of the items whose index value is value.
+func (idx *Index[K, V]) Keys(ctx context.Context, value []byte) (keys []K, err error) {
+	err = idx.collection.store.View(ctx, func(tx Tx) error {
+		return idx.scanEntries(tx, value, true, func(pk []byte) error {
+			key, err := idx.collection.keys.Decode(pk)
+			if err != nil {
+				return &CodecError{Op: "decode", Target: "key", Err: err}
+			}
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	return
+}
+
+// Scan calls fn for the items whose index value is value, in the order of their keys.
+func (idx *Index[K, V]) Scan(ctx context.Context, value []byte, fn func(key K, value V) error) error {
+	return idx.collection.store.View(ctx, func(tx Tx) error {
+		return idx.ScanTx(tx, value, true, fn)
+	})
+}
+
+// ScanPrefix calls fn for the items whose index value starts with prefix, in the order
+// of their index values.
+func (idx *Index[K, V]) ScanPrefix(ctx context.Context, prefix []byte, fn func(key K, value V) error) error {
+	return idx.collection.store.View(ctx, func(tx Tx) error {
+		return idx.ScanTx(tx, prefix, false, fn)
+	})
+}
+
+// ScanTx is Scan within tx, or ScanPrefix when exact is false.
+func (idx *Index[K, V]) ScanTx(tx Tx, value []byte, exact bool, fn func(key K, value V) error) error {
+	c := idx.collection
+	return idx.scanEntries(tx, value, exact, func(pk []byte) error {
+		key, err := c.keys.Decode(pk)
+		if err != nil {
+			return &CodecError{Op: "decode", Target: "key", Err: err}
+		}
+		data, err := tx.Get(c.rawKey(pk))
+		if errors.Is(err, model.ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		v, err := c.decodeValue(data)
+		if err != nil {
+			return err
+		}
+		return fn(key, v)
+	})
+}
+
+// Rebuild drops the entries of the index and indexes every item of the collection again,
+// returning the number of entries written. It runs in batches of transactions, lookups
+// miss the items not indexed yet while it runs.
+func (idx *Index[K, V]) Rebuild(ctx context.Context) (int, error) {
+	c := idx.collection
+	stale, err := idx.listKeys(ctx, idx.prefix)
+	if err != nil {
+		return 0, err
+	}
+	if err := idx.batch(ctx, stale, func(tx Tx, key []byte) error {
+		return tx.Delete(key)
+	}); err != nil {
+		return 0, err
+	}
+	keys, err := idx.listKeys(ctx, c.prefix)
+	if err != nil {
+		return 0, err
+	}
+	var entries int
+	err = idx.batch(ctx, keys, func(tx Tx, key []byte) error {
+		data, err := tx.Get(key)
+		if errors.Is(err, model.ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		value, err := c.decodeValue(data)
+		if err != nil {
+			return err
+		}
+		pk := key[len(c.prefix):]
+		for _, v := range idx.fn(value) {
+			if err := tx.Set(idx.entryKey(v, pk), pk); err != nil {
+				return err
+			}
+			entries++
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// RebuildIndexes rebuilds every index of the collection, see Index.Rebuild, and returns
+// the number of entries written per index name. RunRebuildCommand wraps it as a command.
+func (c *Collection[K, V]) RebuildIndexes(ctx context.Context) (map[string]int, error) {
+	entries := make(map[string]int, len(c.indexes))
+	for _, idx := range c.indexes {
+		n, err := idx.Rebuild(ctx)
+		if err != nil {
+			return entries, fmt.Errorf("collection: rebuild index %s of %s: %w", idx.name, c.name, err)
+		}
+		entries[idx.name] = n
+	}
+	return entries, nil
+}
+
+func (idx *Index[K, V]) listKeys(ctx context.Context, prefix []byte) (keys [][]byte, err error) {
+	err = idx.collection.store.View(ctx, func(tx Tx) error {
+		return tx.Scan(prefix, func(key []byte, value []byte) error {
+			keys = append(keys, append([]byte(nil), key...))
+			return nil
+		})
+	})
+	return
+}
+
+func (idx *Index[K, V]) batch(ctx context.Context, keys [][]byte, fn func(tx Tx, key []byte) error) error {
+	for len(keys) > 0 {
+		n := min(len(keys), rebuildBatchSize)
+		if err := idx.collection.store.Update(ctx, func(tx Tx) error {
+			for _, key := range keys[:n] {
+				if err := fn(tx, key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// scanEntries calls fn with the encoded key of the entries matching value.
+func (idx *Index[K, V]) scanEntries(tx Tx, value []byte, exact bool, fn func(pk []byte) error) error {
+	prefix := append(append([]byte(nil), idx.prefix...), value...)
+	if exact {
+		prefix = append(prefix, 0)
+	}
+	return tx.Scan(prefix, func(key []byte, pk []byte) error {
+		// an index value containing \x00 may share the prefix of an exact match
+		if exact && len(key) != len(prefix)+len(pk) {
+			return nil
+		}
+		return fn(append([]byte(nil), pk...))
+	})
+}
+
+func (idx *Index[K, V]) entryKey(value []byte, pk []byte) []byte {
+	key := make([]byte, 0, len(idx.prefix)+len(value)+1+len(pk))
+	key = append(key, idx.prefix...)
+	key = append(key, value...)
+	key = append(key, 0)
+	return append(key, pk...)
+}
+
+// updateIndexes replaces the index entries of the item stored at key by the ones of
+// value written with set, or removes them when value is nil.
+func (c *Collection[K, V]) updateIndexes(tx Tx, key []byte, value *V, set func(key []byte, value []byte) error) error {
+	if len(c.indexes) == 0 {
+		return nil
+	}
+	var old *V
+	if data, err := tx.Get(key); err == nil {
+		v, err := c.decodeValue(data)
+		if err != nil {
+			return err
+		}
+		old = &v
+	} else if !errors.Is(err, model.ErrNotFound) {
+		return err
+	}
+	pk := key[len(c.prefix):]
+	for _, idx := range c.indexes {
+		var values [][]byte
+		if value != nil {
+			values = idx.fn(*value)
+		}
+		if old != nil {
+			for _, v := range idx.fn(*old) {
+				if containsBytes(values, v) {
+					continue
+				}
+				if err := tx.Delete(idx.entryKey(v, pk)); err != nil {
+					return err
+				}
+			}
+		}
+		for _, v := range values {
+			if err := set(idx.entryKey(v, pk), pk); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func containsBytes(list [][]byte, v []byte) bool {
+	for _, item := range list {
+		if bytes.Equal(item, v) {
+			return true
+		}
+	}
+	return false
+}
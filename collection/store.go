@@ -0,0 +1,203 @@
+package collection
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	dgbadger "github.com/dgraph-io/badger/v4"
+	nuts "github.com/nutsdb/nutsdb"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/model"
+	"github.com/XiBao/db/nutsdb"
+)
+
+var (
+	// ErrStopScan can be returned by a scan callback to end the scan without error.
+	ErrStopScan = badger.ErrStopScan
+	// ErrNegativeTTL is returned by SetWithTTL for a negative ttl.
+	ErrNegativeTTL = badger.ErrNegativeTTL
+)
+
+// Tx is a transaction of a Store. Get returns model.ErrNotFound for a missing or expired
+// key, the keys and values passed to the Scan callback are only valid until it returns.
+//
+// SetWithTTL writes key expiring after ttl, or without expiry when ttl is 0 whatever the
+// default of the store, like the ttl of a nutsdb table. Badger and nutsdb expire keys by
+// the second, ttl is rounded up so that keys never expire early.
+type Tx interface {
+	Get(key []byte) ([]byte, error)
+	Set(key []byte, value []byte) error
+	SetWithTTL(key []byte, value []byte, ttl time.Duration) error
+	Delete(key []byte) error
+	Scan(prefix []byte, fn func(key []byte, value []byte) error) error
+}
+
+// Store is the backend of a Collection, Update commits the transaction when fn returns nil.
+type Store interface {
+	View(ctx context.Context, fn func(tx Tx) error) error
+	Update(ctx context.Context, fn func(tx Tx) error) error
+}
+
+type badgerStore struct {
+	db *badger.DB
+}
+
+// NewBadgerStore runs the collection transactions with DB.RunTxn, retried on conflicts.
+func NewBadgerStore(db *badger.DB) Store {
+	return &badgerStore{db: db}
+}
+
+func (s *badgerStore) View(ctx context.Context, fn func(tx Tx) error) error {
+	return s.db.RunTxn(ctx, false, func(txn *badger.Txn) error {
+		return fn(badgerTx{txn})
+	})
+}
+
+func (s *badgerStore) Update(ctx context.Context, fn func(tx Tx) error) error {
+	return s.db.RunTxn(ctx, true, func(txn *badger.Txn) error {
+		return fn(badgerTx{txn})
+	})
+}
+
+type badgerTx struct {
+	txn *badger.Txn
+}
+
+func (x badgerTx) Get(key []byte) ([]byte, error) {
+	return x.txn.Get(key)
+}
+
+func (x badgerTx) Set(key []byte, value []byte) error {
+	return x.txn.Set(key, value)
+}
+
+func (x badgerTx) SetWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		return ErrNegativeTTL
+	}
+	entry := dgbadger.NewEntry(key, value)
+	if ttl > 0 {
+		// badger expires a key once the second of its expiry started
+		at := time.Now().Add(ttl)
+		entry.ExpiresAt = uint64(at.Unix())
+		if at.Nanosecond() > 0 {
+			entry.ExpiresAt++
+		}
+	}
+	return x.txn.SetEntry(entry)
+}
+
+func (x badgerTx) Delete(key []byte) error {
+	return x.txn.Delete(key)
+}
+
+func (x badgerTx) Scan(prefix []byte, fn func(key []byte, value []byte) error) error {
+	return x.txn.Scan(&badger.ScanOptions{Prefix: prefix}, func(kv *badger.KV) error {
+		return fn(kv.Key, kv.Value)
+	})
+}
+
+type nutsStore struct {
+	table *nutsdb.Table
+}
+
+// NewNutsStore keeps the collections in a nutsdb table, written with the table ttl.
+// Scans and reads of a nutsdb transaction do not see its own pending writes. The values
+// are stored after their key, nutsdb prefix scans only return values.
+func NewNutsStore(table *nutsdb.Table) Store {
+	return &nutsStore{table: table}
+}
+
+func (s *nutsStore) View(ctx context.Context, fn func(tx Tx) error) error {
+	return s.table.View(ctx, func(tx *nuts.Tx) error {
+		return fn(&nutsTx{tx: tx, table: s.table})
+	})
+}
+
+func (s *nutsStore) Update(ctx context.Context, fn func(tx Tx) error) error {
+	return s.table.Update(ctx, func(tx *nuts.Tx) error {
+		return fn(&nutsTx{tx: tx, table: s.table})
+	})
+}
+
+type nutsTx struct {
+	tx    *nuts.Tx
+	table *nutsdb.Table
+}
+
+func (x *nutsTx) Get(key []byte) ([]byte, error) {
+	data, err := x.tx.Get(x.table.Name(), key)
+	if isNutsNotFound(err) {
+		return nil, model.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	_, value, err := decodeNutsValue(data)
+	return value, err
+}
+
+func (x *nutsTx) Set(key []byte, value []byte) error {
+	return x.tx.Put(x.table.Name(), key, encodeNutsValue(key, value), x.table.TTL())
+}
+
+func (x *nutsTx) SetWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		return ErrNegativeTTL
+	}
+	seconds := min((ttl+time.Second-1)/time.Second, math.MaxUint32)
+	return x.tx.Put(x.table.Name(), key, encodeNutsValue(key, value), uint32(seconds))
+}
+
+func (x *nutsTx) Delete(key []byte) error {
+	err := x.tx.Delete(x.table.Name(), key)
+	if isNutsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (x *nutsTx) Scan(prefix []byte, fn func(key []byte, value []byte) error) error {
+	values, err := x.tx.PrefixScan(x.table.Name(), prefix, 0, nuts.ScanNoLimit)
+	if err != nil {
+		if errors.Is(err, nuts.ErrPrefixScan) || errors.Is(err, nuts.ErrBucketNotExist) || errors.Is(err, nuts.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	}
+	for _, data := range values {
+		key, value, err := decodeNutsValue(data)
+		if err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			if errors.Is(err, ErrStopScan) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeNutsValue prefixes value with the uvarint length of key and key.
+func encodeNutsValue(key []byte, value []byte) []byte {
+	data := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen32+len(key)+len(value)), uint64(len(key)))
+	return append(append(data, key...), value...)
+}
+
+func decodeNutsValue(data []byte) (key []byte, value []byte, err error) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || uint64(len(data)-size) < n {
+		return nil, nil, errors.New("collection: corrupted nutsdb value")
+	}
+	data = data[size:]
+	return data[:n], data[n:], nil
+}
+
+func isNutsNotFound(err error) bool {
+	return errors.Is(err, nuts.ErrNotFoundKey) || errors.Is(err, nuts.ErrKeyNotFound)
+}
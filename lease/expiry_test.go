@@ -0,0 +1,52 @@
+package lease
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/XiBao/db/badger/badgertest"
+	"github.com/XiBao/db/collection"
+	"github.com/XiBao/db/model"
+)
+
+func TestExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := collection.NewBadgerStore(badgertest.New(t).DB)
+	now := time.Unix(1700000000, 0)
+	leases, err := NewManager(store, "lease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leases.now = func() time.Time { return now }
+
+	a, err := leases.Acquire(ctx, "job", "a", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, leases.Renew(ctx, a, 10*time.Second))
+	assert.Equal(t, now.Add(10*time.Second), a.ExpiresAt)
+
+	now = now.Add(9 * time.Second)
+	held, err := leases.Get(ctx, "job")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", held.Owner)
+
+	now = now.Add(time.Second)
+	assert.True(t, a.Expired(now))
+	_, err = leases.Get(ctx, "job")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+	assert.ErrorIs(t, leases.Renew(ctx, a, time.Minute), ErrLost)
+	assert.ErrorIs(t, store.View(ctx, func(tx collection.Tx) error {
+		return leases.Fence(tx, a)
+	}), ErrLost)
+
+	// the token still grows once the lease expired
+	b, err := leases.Acquire(ctx, "job", "b", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, a.Token+1, b.Token)
+	assert.ErrorIs(t, leases.Release(ctx, a), ErrLost)
+	again, err := leases.Acquire(ctx, "job", "a", time.Minute)
+	assert.ErrorIs(t, err, ErrHeld)
+	assert.Nil(t, again)
+}
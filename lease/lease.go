@@ -0,0 +1,231 @@
+// Package lease provides leases with fencing tokens over a collection.Store, so that
+// goroutines or processes sharing a store can elect the owner of a job.
+//
+// Badger and nutsdb lock their directory, only the goroutines of the process opening it
+// share their leases. Processes of one host share the leases of a collection.NewFileStore
+// of a common directory, other processes must ask the one serving the store, e.g. over RPC.
+package lease
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/XiBao/db/collection"
+	"github.com/XiBao/db/model"
+)
+
+var (
+	// ErrHeld is returned by Acquire while another owner holds the lease.
+	ErrHeld = errors.New("lease held by another owner")
+	// ErrLost is returned when a lease expired and was acquired again, or was released.
+	ErrLost = errors.New("lease lost")
+	// ErrInvalidLease is returned for an empty name or owner, or a ttl that is not positive.
+	ErrInvalidLease = errors.New("invalid lease")
+)
+
+// Lease is a lease granted by Acquire. Token grows every time the lease changes owner or
+// is acquired again after being released or expired, resources guarded by the lease should
+// reject writes carrying a token lower than the last one they saw.
+type Lease struct {
+	Name      string
+	Owner     string
+	Token     uint64
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the lease expired at now.
+func (l *Lease) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// record is the holder of a lease, stored with the ttl of the lease, or the last token
+// of a lease, stored without expiry.
+type record struct {
+	Owner     string `json:"owner,omitempty"`
+	Token     uint64 `json:"token"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+func (r *record) held(now time.Time) bool {
+	return r.Owner != "" && now.UnixNano() < r.ExpiresAt
+}
+
+// Manager grants the leases stored in two collections of a store, name for the tokens
+// and name.holder for the holders.
+//
+// The holder of a lease is written with the ttl of the lease, so the store drops it once
+// expired, and deleted on release. The token is kept without expiry so that it never goes
+// back. The store expires keys by the second, the expiry of the holder is therefore also
+// checked against its ExpiresAt.
+//
+// A Manager serializes its writes instead of relying on the store to detect conflicting
+// transactions, which badger does not with DetectConflicts off, e.g. with LowMemOptions.
+// Use one Manager per collection and process. Fence only protects the writes of a store
+// serializing its transactions or detecting conflicts, like nutsdb, the file store or
+// badger with DetectConflicts.
+type Manager struct {
+	tokens  *collection.Collection[string, record]
+	holders *collection.Collection[string, record]
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+// NewManager stores the leases in the collections name and name.holder of store.
+func NewManager(store collection.Store, name string) (*Manager, error) {
+	tokens, err := collection.New(store, name, collection.String{}, collection.JSON[record]{})
+	if err != nil {
+		return nil, err
+	}
+	holders, err := collection.New(store, name+".holder", collection.String{}, collection.JSON[record]{})
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{tokens: tokens, holders: holders, now: time.Now}, nil
+}
+
+// Acquire grants name to owner for ttl when it is free, released or expired, with a new
+// token. An owner acquiring a lease it still holds extends it and keeps its token.
+func (m *Manager) Acquire(ctx context.Context, name string, owner string, ttl time.Duration) (*Lease, error) {
+	if name == "" || owner == "" || ttl <= 0 {
+		return nil, ErrInvalidLease
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var lease *Lease
+	err := m.holders.Store().Update(ctx, func(tx collection.Tx) error {
+		now := m.now()
+		holder, err := m.holder(tx, name, now)
+		if err != nil && !errors.Is(err, model.ErrNotFound) {
+			return err
+		}
+		if err == nil && holder.Owner != owner {
+			return ErrHeld
+		}
+		if err != nil {
+			token, err := m.tokens.GetTx(tx, name)
+			if err != nil && !errors.Is(err, model.ErrNotFound) {
+				return err
+			}
+			token = record{Token: token.Token + 1}
+			if err := m.tokens.SetWithTTLTx(tx, name, token, 0); err != nil {
+				return err
+			}
+			holder = record{Owner: owner, Token: token.Token}
+		}
+		holder.ExpiresAt = now.Add(ttl).UnixNano()
+		if err := m.holders.SetWithTTLTx(tx, name, holder, ttl); err != nil {
+			return err
+		}
+		lease = holder.lease(name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// Renew extends lease for ttl from now, ErrLost when it is no longer held.
+func (m *Manager) Renew(ctx context.Context, lease *Lease, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidLease
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.holders.Store().Update(ctx, func(tx collection.Tx) error {
+		now := m.now()
+		rec, err := m.current(tx, lease, now)
+		if err != nil {
+			return err
+		}
+		rec.ExpiresAt = now.Add(ttl).UnixNano()
+		if err := m.holders.SetWithTTLTx(tx, lease.Name, rec, ttl); err != nil {
+			return err
+		}
+		lease.ExpiresAt = time.Unix(0, rec.ExpiresAt)
+		return nil
+	})
+}
+
+// Release frees lease before it expires. Releasing an expired lease nobody acquired
+// since is not an error, ErrLost is returned when another owner holds it.
+func (m *Manager) Release(ctx context.Context, lease *Lease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.holders.Store().Update(ctx, func(tx collection.Tx) error {
+		holder, err := m.holders.GetTx(tx, lease.Name)
+		if errors.Is(err, model.ErrNotFound) {
+			token, err := m.tokens.GetTx(tx, lease.Name)
+			if err != nil && !errors.Is(err, model.ErrNotFound) {
+				return err
+			}
+			if token.Token != lease.Token {
+				return ErrLost
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if holder.Owner != lease.Owner || holder.Token != lease.Token {
+			return ErrLost
+		}
+		return m.holders.DeleteTx(tx, lease.Name)
+	})
+}
+
+// Get returns the current holder of name, model.ErrNotFound when it is free.
+func (m *Manager) Get(ctx context.Context, name string) (lease *Lease, err error) {
+	err = m.holders.Store().View(ctx, func(tx collection.Tx) error {
+		holder, err := m.holder(tx, name, m.now())
+		if err != nil {
+			return err
+		}
+		lease = holder.lease(name)
+		return nil
+	})
+	return
+}
+
+// Fence returns ErrLost unless lease is still held, so that writes in tx to the same
+// store are only committed by the current owner.
+func (m *Manager) Fence(tx collection.Tx, lease *Lease) error {
+	_, err := m.current(tx, lease, m.now())
+	return err
+}
+
+func (m *Manager) current(tx collection.Tx, lease *Lease, now time.Time) (record, error) {
+	holder, err := m.holder(tx, lease.Name, now)
+	if errors.Is(err, model.ErrNotFound) {
+		return holder, ErrLost
+	} else if err != nil {
+		return holder, err
+	}
+	if holder.Owner != lease.Owner || holder.Token != lease.Token {
+		return holder, ErrLost
+	}
+	return holder, nil
+}
+
+// holder returns the holder of name, model.ErrNotFound when the lease is free or expired
+// at now but not dropped by the store yet.
+func (m *Manager) holder(tx collection.Tx, name string, now time.Time) (record, error) {
+	holder, err := m.holders.GetTx(tx, name)
+	if err != nil {
+		return holder, err
+	}
+	if !holder.held(now) {
+		return holder, model.ErrNotFound
+	}
+	return holder, nil
+}
+
+func (r *record) lease(name string) *Lease {
+	return &Lease{
+		Name:      name,
+		Owner:     r.Owner,
+		Token:     r.Token,
+		ExpiresAt: time.Unix(0, r.ExpiresAt),
+	}
+}
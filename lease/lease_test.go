@@ -0,0 +1,232 @@
+package lease_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	nuts "github.com/nutsdb/nutsdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/badger/badgertest"
+	"github.com/XiBao/db/collection"
+	"github.com/XiBao/db/lease"
+	"github.com/XiBao/db/model"
+	"github.com/XiBao/db/nutsdb"
+)
+
+func stores(t *testing.T) map[string]collection.Store {
+	ndb, err := nuts.Open(nuts.DefaultOptions, nuts.WithDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ndb.Close() })
+	table, err := nutsdb.NewTable(ndb, "test", nuts.Persistent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := collection.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lowMem := badger.InMemoryOptions(context.Background()).WithDetectConflicts(false)
+	return map[string]collection.Store{
+		"badger":              collection.NewBadgerStore(badgertest.New(t).DB),
+		"badger no conflicts": collection.NewBadgerStore(badgertest.Open(t, lowMem).DB),
+		"nutsdb":              collection.NewNutsStore(table),
+		"file":                file,
+	}
+}
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			leases, err := lease.NewManager(store, "lease")
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, err := leases.Acquire(ctx, "job", "a", time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(1), a.Token)
+
+			_, err = leases.Acquire(ctx, "job", "b", time.Minute)
+			assert.ErrorIs(t, err, lease.ErrHeld)
+			again, err := leases.Acquire(ctx, "job", "a", time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, a.Token, again.Token)
+			assert.NoError(t, leases.Renew(ctx, a, time.Minute))
+			assert.NoError(t, store.View(ctx, func(tx collection.Tx) error {
+				return leases.Fence(tx, a)
+			}))
+
+			assert.NoError(t, leases.Release(ctx, a))
+			assert.NoError(t, leases.Release(ctx, a))
+			assert.ErrorIs(t, leases.Renew(ctx, a, time.Minute), lease.ErrLost)
+			assert.ErrorIs(t, store.View(ctx, func(tx collection.Tx) error {
+				return leases.Fence(tx, a)
+			}), lease.ErrLost)
+			b, err := leases.Acquire(ctx, "job", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(2), b.Token)
+			assert.ErrorIs(t, leases.Release(ctx, a), lease.ErrLost)
+
+			_, err = leases.Acquire(ctx, "", "c", time.Minute)
+			assert.ErrorIs(t, err, lease.ErrInvalidLease)
+		})
+	}
+}
+
+func TestLeaseConcurrent(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			leases, err := lease.NewManager(store, "lease")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var (
+				wg     sync.WaitGroup
+				mu     sync.Mutex
+				owners []string
+			)
+			for _, owner := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := leases.Acquire(ctx, "job", owner, time.Minute); err == nil {
+						mu.Lock()
+						owners = append(owners, owner)
+						mu.Unlock()
+					} else {
+						assert.ErrorIs(t, err, lease.ErrHeld)
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Len(t, owners, 1)
+		})
+	}
+}
+
+func TestLeaseStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	leases, err := lease.NewManager(collection.NewBadgerStore(h.DB), "lease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := leases.Acquire(ctx, "job", "a", time.Minute)
+	assert.NoError(t, err)
+
+	// the holder expires with the lease, the token never does
+	ttl, err := h.DB.GetTTL(ctx, []byte("lease.holder:job"))
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(2*time.Second))
+	ttl, err = h.DB.GetTTL(ctx, []byte("lease:job"))
+	assert.NoError(t, err)
+	assert.Equal(t, badger.PersistentTTL, ttl)
+
+	assert.NoError(t, leases.Renew(ctx, a, time.Hour))
+	ttl, err = h.DB.GetTTL(ctx, []byte("lease.holder:job"))
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(2*time.Second))
+
+	assert.NoError(t, leases.Release(ctx, a))
+	_, err = h.DB.GetTTL(ctx, []byte("lease.holder:job"))
+	assert.ErrorIs(t, err, model.ErrNotFound)
+	_, err = leases.Get(ctx, "job")
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	// dropped by the store once expired
+	b, err := leases.Acquire(ctx, "job", "b", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, a.Token+1, b.Token)
+	assert.Eventually(t, func() bool {
+		_, err := h.DB.GetTTL(ctx, []byte("lease.holder:job"))
+		return errors.Is(err, model.ErrNotFound)
+	}, 5*time.Second, 50*time.Millisecond)
+	c, err := leases.Acquire(ctx, "job", "c", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, b.Token+1, c.Token)
+}
+
+// TestLeaseProcesses runs itself in processes acquiring one lease of a file store.
+func TestLeaseProcesses(t *testing.T) {
+	ctx := context.Background()
+	if dir := os.Getenv("LEASE_TEST_DIR"); dir != "" {
+		store, err := collection.NewFileStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leases, err := lease.NewManager(store, "lease")
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := leases.Acquire(ctx, "job", os.Getenv("LEASE_TEST_OWNER"), time.Minute)
+		if errors.Is(err, lease.ErrHeld) {
+			fmt.Println("held")
+			return
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Println("acquired", l.Token)
+		return
+	}
+	if testing.Short() {
+		t.Skip("starts processes")
+	}
+
+	dir := t.TempDir()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		outputs []string
+	)
+	for _, owner := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestLeaseProcesses$")
+			cmd.Env = append(os.Environ(), "LEASE_TEST_DIR="+dir, "LEASE_TEST_OWNER="+owner)
+			out, err := cmd.Output()
+			assert.NoError(t, err)
+			mu.Lock()
+			outputs = append(outputs, string(out))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	var acquired []string
+	held := 0
+	for _, out := range outputs {
+		for _, line := range strings.Split(out, "\n") {
+			if token, ok := strings.CutPrefix(line, "acquired "); ok {
+				acquired = append(acquired, token)
+			} else if line == "held" {
+				held++
+			}
+		}
+	}
+	assert.Equal(t, 3, held)
+	assert.Equal(t, []string{"1"}, acquired)
+
+	// this process sees the lease of the other ones
+	store, err := collection.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leases, err := lease.NewManager(store, "lease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = leases.Acquire(ctx, "job", "e", time.Minute)
+	assert.ErrorIs(t, err, lease.ErrHeld)
+}
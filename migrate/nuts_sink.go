@@ -0,0 +1,39 @@
+package migrate
+
+import (
+	"context"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/nutsdb"
+)
+
+const tableSinkBatchSize = 1000
+
+type tableSink struct {
+	table *nutsdb.Table
+}
+
+// NewTableSink is a badger.StreamSink writing the streamed kvs to a nutsdb table
+// with the table ttl, e.g. to move a prefix of a badger store to nutsdb with DB.Stream.
+func NewTableSink(table *nutsdb.Table) badger.StreamSink {
+	return &tableSink{table: table}
+}
+
+func (s *tableSink) Write(ctx context.Context, kvs []*badger.KV) error {
+	for len(kvs) > 0 {
+		n := min(len(kvs), tableSinkBatchSize)
+		args := make([][]byte, 0, n*2)
+		for _, kv := range kvs[:n] {
+			args = append(args, kv.Key, kv.Value)
+		}
+		if err := s.table.BatchSet(ctx, args...); err != nil {
+			return err
+		}
+		kvs = kvs[n:]
+	}
+	return nil
+}
+
+func (s *tableSink) Close(ctx context.Context) error {
+	return nil
+}
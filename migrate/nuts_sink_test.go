@@ -0,0 +1,48 @@
+package migrate_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	dgbadger "github.com/dgraph-io/badger/v4"
+	nuts "github.com/nutsdb/nutsdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/XiBao/db/badger/badgertest"
+	"github.com/XiBao/db/migrate"
+	"github.com/XiBao/db/nutsdb"
+)
+
+func TestTableSink(t *testing.T) {
+	ctx := context.Background()
+	h := badgertest.New(t)
+	var entries []*dgbadger.Entry
+	for i := range 1500 {
+		entries = append(entries, dgbadger.NewEntry([]byte(fmt.Sprintf("user:%04d", i)), []byte(fmt.Sprint(i))))
+	}
+	entries = append(entries, dgbadger.NewEntry([]byte("order:1"), []byte("o")))
+	assert.NoError(t, h.DB.Update(ctx, entries...))
+
+	db, err := nuts.Open(nuts.DefaultOptions, nuts.WithDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	table, err := nutsdb.NewTable(db, "users", nuts.Persistent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, h.DB.Stream(ctx, []byte("user:"), 2, nil, migrate.NewTableSink(table)))
+	assert.NoError(t, table.View(ctx, func(tx *nuts.Tx) error {
+		keys, err := tx.GetKeys(table.Name())
+		assert.Len(t, keys, 1500)
+		return err
+	}))
+	assert.NoError(t, table.Get(ctx, []byte("user:1234"), func(val []byte) error {
+		assert.Equal(t, "1234", string(val))
+		return nil
+	}))
+	assert.Error(t, table.Get(ctx, []byte("order:1"), func([]byte) error { return nil }))
+}
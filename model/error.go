@@ -5,4 +5,6 @@ import "errors"
 var (
 	ErrEmptyKey = errors.New("empty key")
 	ErrNotFound = errors.New("not found")
+
+	ErrZeroBandwidth = errors.New("sequence bandwidth must be greater than zero")
 )
@@ -0,0 +1,15 @@
+package model
+
+import "context"
+
+// Sequence hands out increasing ids persisted by the store, from 0. Ids are leased from
+// the store bandwidth at a time, the ones leased but not handed out before Close or a
+// crash are skipped, so ids are unique and increasing but may have gaps.
+type Sequence interface {
+	Next(ctx context.Context) (uint64, error)
+	// NextN returns n ids, concurrent calls on the same sequence may interleave them.
+	// On error it returns no ids, the ones taken before the error are skipped.
+	NextN(ctx context.Context, n int) ([]uint64, error)
+	// Close returns the unused ids of the lease to the store when nobody leased after it.
+	Close(ctx context.Context) error
+}
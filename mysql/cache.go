@@ -0,0 +1,475 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XiBao/goutil"
+	dgbadger "github.com/dgraph-io/badger/v4"
+	"github.com/ziutek/mymysql/autorc"
+	"github.com/ziutek/mymysql/mysql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/XiBao/db/badger"
+	"github.com/XiBao/db/model"
+	"github.com/XiBao/db/nutsdb"
+	"github.com/XiBao/db/query"
+)
+
+var (
+	CacheHitKey    = attribute.Key("db.cache.hit")
+	CacheTablesKey = attribute.Key("db.cache.tables")
+)
+
+var errUncacheable = errors.New("mysql: uncacheable value")
+
+// CacheStore stores encoded query results, Get returns model.ErrNotFound on a miss.
+type CacheStore interface {
+	Get(ctx context.Context, key []byte) ([]byte, error)
+	Set(ctx context.Context, key []byte, value []byte, ttl time.Duration) error
+}
+
+// WithCache enables the read-through cache for SELECT queries, results live for ttl.
+// Selects locking rows, reading no table or calling functions such as NOW(), RAND()
+// or LAST_INSERT_ID() always go to the server.
+// Writes issued through the DB invalidate the tables they touch, InvalidateCache
+// does it explicitly for writes made elsewhere.
+func WithCache(store CacheStore, ttl time.Duration) Option {
+	return func(opt *option) {
+		opt.cacheStore = store
+		opt.cacheTTL = ttl
+	}
+}
+
+type skipCacheKey struct{}
+
+// SkipCache makes queries run with ctx bypass the cache.
+func SkipCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipCacheKey{}, true)
+}
+
+type badgerCacheStore struct {
+	db *badger.DB
+}
+
+// NewBadgerCacheStore stores cached results in a badger.DB.
+func NewBadgerCacheStore(db *badger.DB) CacheStore {
+	return &badgerCacheStore{db: db}
+}
+
+func (s *badgerCacheStore) Get(ctx context.Context, key []byte) (value []byte, err error) {
+	err = s.db.View(ctx, key, func(val []byte) error {
+		value = append([]byte(nil), val...)
+		return nil
+	})
+	return
+}
+
+func (s *badgerCacheStore) Set(ctx context.Context, key []byte, value []byte, ttl time.Duration) error {
+	entry := dgbadger.NewEntry(key, value)
+	if ttl > 0 {
+		entry = entry.WithTTL(ttl)
+	}
+	return s.db.Update(ctx, entry)
+}
+
+type nutsCacheStore struct {
+	table *nutsdb.Table
+}
+
+// NewNutsCacheStore stores cached results in a nutsdb.Table.
+func NewNutsCacheStore(table *nutsdb.Table) CacheStore {
+	return &nutsCacheStore{table: table}
+}
+
+func (s *nutsCacheStore) Get(ctx context.Context, key []byte) (value []byte, err error) {
+	err = s.table.Get(ctx, key, func(val []byte) error {
+		value = append([]byte(nil), val...)
+		return nil
+	})
+	return
+}
+
+func (s *nutsCacheStore) Set(ctx context.Context, key []byte, value []byte, ttl time.Duration) error {
+	var seconds uint32
+	if ttl > 0 {
+		seconds = uint32((ttl + time.Second - 1) / time.Second)
+	}
+	return s.table.SetWithTTL(ctx, key, value, seconds)
+}
+
+type queryCache struct {
+	store  CacheStore
+	ttl    time.Duration
+	prefix string
+	hits   metric.Int64Counter
+	misses metric.Int64Counter
+}
+
+func newQueryCache(t *DB) (*queryCache, error) {
+	ret := &queryCache{
+		store:  t.option.cacheStore,
+		ttl:    t.option.cacheTTL,
+		prefix: goutil.StringsJoin("mysql:cache:", t.dbName, ":"),
+	}
+	var err error
+	if ret.hits, err = t.meter.Int64Counter("db.client.cache.hits",
+		metric.WithDescription("Number of queries answered from the result cache"),
+		metric.WithUnit("{query}"),
+	); err != nil {
+		return nil, err
+	}
+	if ret.misses, err = t.meter.Int64Counter("db.client.cache.misses",
+		metric.WithDescription("Number of cacheable queries sent to the server"),
+		metric.WithUnit("{query}"),
+	); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// InvalidateCache drops the cached results of every query reading one of tables.
+func (t *DB) InvalidateCache(ctx context.Context, tables ...string) error {
+	if t.cache == nil {
+		return nil
+	}
+	return t.withSpan(ctx, "db.InvalidateCache", "", nil,
+		func(ctx context.Context, span trace.Span) error {
+			if span != nil && span.IsRecording() {
+				span.SetAttributes(CacheTablesKey.StringSlice(tables))
+			}
+			return t.cache.invalidate(ctx, tables)
+		})
+}
+
+// query runs sql through the cache when it applies, first only fetches the first row.
+func (t *DB) query(ctx context.Context, span trace.Span, first bool, sql string, params []interface{}) (rows []mysql.Row, res mysql.Result, err error) {
+	exec := func() error {
+		return t.do(ctx, span, func(conn *autorc.Conn) (err error) {
+			if first {
+				var row mysql.Row
+				row, res, err = conn.QueryFirst(sql, params...)
+				if row != nil {
+					rows = []mysql.Row{row}
+				}
+			} else {
+				rows, res, err = conn.Query(sql, params...)
+			}
+			return err
+		})
+	}
+	if t.cache == nil {
+		err = exec()
+		return
+	}
+	if skip, _ := ctx.Value(skipCacheKey{}).(bool); skip {
+		err = exec()
+		return
+	}
+	fingerprint := query.Fingerprint(sql)
+	if !isSelect(fingerprint) {
+		if err = exec(); err == nil && isWrite(fingerprint) {
+			if tables := extractTables(sql); len(tables) > 0 {
+				if e := t.cache.invalidate(ctx, tables); e != nil && span != nil && span.IsRecording() {
+					span.RecordError(e)
+				}
+			}
+		}
+		return
+	}
+	tables := extractTables(sql)
+	if len(tables) == 0 || !isCacheable(fingerprint) {
+		err = exec()
+		return
+	}
+	key, keyErr := t.cache.key(ctx, first, fingerprint, sql, params, tables)
+	if keyErr == nil {
+		if cached, e := t.cache.store.Get(ctx, key); e == nil {
+			if rows, res, e = decodeCached(cached); e == nil {
+				t.cache.record(ctx, t, span, true)
+				return
+			}
+		}
+	}
+	t.cache.record(ctx, t, span, false)
+	if err = exec(); err != nil || keyErr != nil {
+		return
+	}
+	if encoded, e := encodeCached(rows, res); e == nil {
+		if e = t.cache.store.Set(ctx, key, encoded, t.cache.ttl); e != nil && span != nil && span.IsRecording() {
+			span.RecordError(e)
+		}
+	}
+	return
+}
+
+func (c *queryCache) record(ctx context.Context, t *DB, span trace.Span, hit bool) {
+	if span != nil && span.IsRecording() {
+		span.SetAttributes(CacheHitKey.Bool(hit))
+	}
+	if !t.MetricEnabled() {
+		return
+	}
+	if hit {
+		c.hits.Add(ctx, 1, metric.WithAttributes(t.attrs...))
+	} else {
+		c.misses.Add(ctx, 1, metric.WithAttributes(t.attrs...))
+	}
+}
+
+// key is prefix + query.Id of the fingerprint + a hash of the concrete query and the
+// versions of the tables it reads, bumping a version orphans the old entries.
+func (c *queryCache) key(ctx context.Context, first bool, fingerprint string, sql string, params []interface{}, tables []string) ([]byte, error) {
+	concrete := sql
+	if len(params) > 0 {
+		concrete = fmt.Sprintf(sql, params...)
+	}
+	var buf strings.Builder
+	buf.WriteString(concrete)
+	if first {
+		buf.WriteString("\x00first")
+	}
+	for _, table := range tables {
+		version, err := c.store.Get(ctx, c.tableKey(table))
+		if err != nil && !errors.Is(err, model.ErrNotFound) {
+			return nil, err
+		}
+		buf.WriteByte(0)
+		buf.WriteString(table)
+		buf.Write(version)
+	}
+	return []byte(goutil.StringsJoin(c.prefix, query.Id(fingerprint), ":",
+		strconv.FormatUint(goutil.StringToUint64(buf.String()), 16))), nil
+}
+
+func (c *queryCache) tableKey(table string) []byte {
+	return []byte(goutil.StringsJoin(c.prefix, "table:", table))
+}
+
+func (c *queryCache) invalidate(ctx context.Context, tables []string) error {
+	version := make([]byte, 8)
+	binary.BigEndian.PutUint64(version, uint64(time.Now().UnixNano()))
+	var errs []error
+	for _, table := range tables {
+		if err := c.store.Set(ctx, c.tableKey(normalizeTable(table)), version, 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	tableRegexp = regexp.MustCompile("(?i)\\b(?:from|join|into|update|table)\\s+(`?[\\w$]+`?(?:\\.`?[\\w$]+`?)?)")
+	// uncacheableRegexp matches the fingerprints of selects which lock rows, write or
+	// return a different result on every run
+	uncacheableRegexp = regexp.MustCompile(`\b(?:for update|for share|lock in share mode|sql_no_cache|into)\b|@|` +
+		`\b(?:now|sysdate|curdate|curtime|current_date|current_time|current_timestamp|localtime|localtimestamp|` +
+		`unix_timestamp|utc_date|utc_time|utc_timestamp|rand|uuid|uuid_short|last_insert_id|found_rows|row_count|` +
+		`connection_id|current_user|session_user|system_user|user|database|get_lock|release_lock|is_free_lock|` +
+		`is_used_lock|sleep)\s*\(|\b(?:current_date|current_time|current_timestamp|localtime|localtimestamp)\b`)
+	tableListRegexp = regexp.MustCompile("(?i)\\bfrom\\s+([`\\w$.]+(?:\\s+(?:as\\s+)?[\\w$]+)?(?:\\s*,\\s*[`\\w$.]+(?:\\s+(?:as\\s+)?[\\w$]+)?)+)")
+)
+
+// extractTables returns the normalized names of the tables referenced by sql.
+func extractTables(sql string) []string {
+	seen := make(map[string]struct{})
+	var tables []string
+	add := func(name string) {
+		name = normalizeTable(name)
+		if name == "" {
+			return
+		}
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			tables = append(tables, name)
+		}
+	}
+	for _, m := range tableRegexp.FindAllStringSubmatch(sql, -1) {
+		add(m[1])
+	}
+	for _, m := range tableListRegexp.FindAllStringSubmatch(sql, -1) {
+		for _, item := range strings.Split(m[1], ",") {
+			if fields := strings.Fields(item); len(fields) > 0 {
+				add(fields[0])
+			}
+		}
+	}
+	return tables
+}
+
+func normalizeTable(name string) string {
+	name = strings.ReplaceAll(name, "`", "")
+	if idx := strings.LastIndexByte(name, '.'); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return strings.ToLower(name)
+}
+
+func isSelect(fingerprint string) bool {
+	return strings.HasPrefix(fingerprint, "select ")
+}
+
+// isCacheable tells whether the result of a select only depends on the tables it reads.
+func isCacheable(fingerprint string) bool {
+	return !uncacheableRegexp.MatchString(fingerprint)
+}
+
+func isWrite(fingerprint string) bool {
+	for _, prefix := range []string{"insert ", "update ", "delete ", "replace ", "truncate ", "alter ", "drop ", "load "} {
+		if strings.HasPrefix(fingerprint, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedCell keeps NULL apart from an empty value, which gob can not do for interfaces.
+type cachedCell struct {
+	Kind  byte
+	Bytes []byte
+	Int   int64
+	Uint  uint64
+	Float float64
+	Time  time.Time
+}
+
+const (
+	cellNull byte = iota
+	cellBytes
+	cellString
+	cellInt
+	cellUint
+	cellFloat
+	cellTime
+)
+
+type cachedResult struct {
+	Fields       []mysql.Field
+	Rows         [][]cachedCell
+	AffectedRows uint64
+	InsertId     uint64
+	WarnCount    int
+	Message      string
+}
+
+func encodeCached(rows []mysql.Row, res mysql.Result) ([]byte, error) {
+	cached := cachedResult{Rows: make([][]cachedCell, len(rows))}
+	if res != nil {
+		for _, f := range res.Fields() {
+			cached.Fields = append(cached.Fields, *f)
+		}
+		cached.AffectedRows = res.AffectedRows()
+		cached.InsertId = res.InsertId()
+		cached.WarnCount = res.WarnCount()
+		cached.Message = res.Message()
+	}
+	for idx, row := range rows {
+		cells := make([]cachedCell, len(row))
+		for col, v := range row {
+			switch val := v.(type) {
+			case nil:
+				cells[col].Kind = cellNull
+			case []byte:
+				cells[col] = cachedCell{Kind: cellBytes, Bytes: val}
+			case string:
+				cells[col] = cachedCell{Kind: cellString, Bytes: []byte(val)}
+			case int64:
+				cells[col] = cachedCell{Kind: cellInt, Int: val}
+			case int:
+				cells[col] = cachedCell{Kind: cellInt, Int: int64(val)}
+			case uint64:
+				cells[col] = cachedCell{Kind: cellUint, Uint: val}
+			case float64:
+				cells[col] = cachedCell{Kind: cellFloat, Float: val}
+			case time.Time:
+				cells[col] = cachedCell{Kind: cellTime, Time: val}
+			default:
+				return nil, fmt.Errorf("%w: %T", errUncacheable, v)
+			}
+		}
+		cached.Rows[idx] = cells
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cached); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeCached(data []byte) ([]mysql.Row, mysql.Result, error) {
+	var cached cachedResult
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&cached); err != nil {
+		return nil, nil, err
+	}
+	rows := make([]mysql.Row, len(cached.Rows))
+	for idx, cells := range cached.Rows {
+		row := make(mysql.Row, len(cells))
+		for col, cell := range cells {
+			switch cell.Kind {
+			case cellBytes:
+				if cell.Bytes == nil {
+					row[col] = []byte{}
+				} else {
+					row[col] = cell.Bytes
+				}
+			case cellString:
+				row[col] = string(cell.Bytes)
+			case cellInt:
+				row[col] = cell.Int
+			case cellUint:
+				row[col] = cell.Uint
+			case cellFloat:
+				row[col] = cell.Float
+			case cellTime:
+				row[col] = cell.Time
+			}
+		}
+		rows[idx] = row
+	}
+	res := &cacheResult{cached: cached, fields: make([]*mysql.Field, len(cached.Fields))}
+	for idx := range cached.Fields {
+		res.fields[idx] = &cached.Fields[idx]
+	}
+	return rows, res, nil
+}
+
+// cacheResult is the mysql.Result of a cache hit, rows are already read.
+type cacheResult struct {
+	cached cachedResult
+	fields []*mysql.Field
+}
+
+func (r *cacheResult) StatusOnly() bool                  { return len(r.fields) == 0 }
+func (r *cacheResult) ScanRow(mysql.Row) error           { return mysql.ErrReadAfterEOR }
+func (r *cacheResult) GetRow() (mysql.Row, error)        { return nil, nil }
+func (r *cacheResult) MoreResults() bool                 { return false }
+func (r *cacheResult) NextResult() (mysql.Result, error) { return nil, nil }
+func (r *cacheResult) Fields() []*mysql.Field            { return r.fields }
+func (r *cacheResult) Message() string                   { return r.cached.Message }
+func (r *cacheResult) AffectedRows() uint64              { return r.cached.AffectedRows }
+func (r *cacheResult) InsertId() uint64                  { return r.cached.InsertId }
+func (r *cacheResult) WarnCount() int                    { return r.cached.WarnCount }
+func (r *cacheResult) MakeRow() mysql.Row                { return make(mysql.Row, len(r.fields)) }
+func (r *cacheResult) GetRows() ([]mysql.Row, error)     { return nil, nil }
+func (r *cacheResult) End() error                        { return nil }
+func (r *cacheResult) GetFirstRow() (mysql.Row, error)   { return nil, nil }
+func (r *cacheResult) GetLastRow() (mysql.Row, error)    { return nil, nil }
+
+func (r *cacheResult) Map(name string) int {
+	for idx, f := range r.fields {
+		if f.Name == name {
+			return idx
+		}
+	}
+	return -1
+}
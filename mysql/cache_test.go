@@ -0,0 +1,41 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/XiBao/db/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractTables(t *testing.T) {
+	assert.Equal(t, []string{"orders"}, extractTables("SELECT * FROM `shop`.`Orders` WHERE id = 1"))
+	assert.Equal(t, []string{"orders", "items"},
+		extractTables("select * from orders o join items i on i.order_id = o.id"))
+	assert.Equal(t, []string{"orders", "items", "users"},
+		extractTables("select * from orders o, items as i, users where 1"))
+	assert.Equal(t, []string{"orders"}, extractTables("UPDATE orders SET state = 1"))
+	assert.Equal(t, []string{"orders"}, extractTables("insert into orders values (1)"))
+	assert.Empty(t, extractTables("select 1"))
+}
+
+func TestIsCacheable(t *testing.T) {
+	for sql, cacheable := range map[string]bool{
+		"select * from orders where id = 1":                    true,
+		"select count(*) from orders where created_at > '1'":   true,
+		"select * from orders where id = 1 for update":         false,
+		"SELECT * FROM orders WHERE id = 1 FOR SHARE":          false,
+		"select * from orders lock in share mode":              false,
+		"select * from orders where created_at < NOW()":        false,
+		"select * from orders where day = current_date":        false,
+		"select * from orders order by rand() limit 1":         false,
+		"select LAST_INSERT_ID()":                              false,
+		"select FOUND_ROWS()":                                  false,
+		"select GET_LOCK('orders', 10)":                        false,
+		"select sql_no_cache * from orders":                    false,
+		"select id into @id from orders limit 1":               false,
+		"select * from orders where owner = @@session.user":    false,
+		"select random_id, now_state from orders where id = 1": true,
+	} {
+		assert.Equal(t, cacheable, isSelect(query.Fingerprint(sql)) && isCacheable(query.Fingerprint(sql)), sql)
+	}
+}
@@ -0,0 +1,356 @@
+package mysql
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/XiBao/goutil"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrConfigRequired   = errors.New("required")
+	ErrConfigInvalid    = errors.New("invalid value")
+	ErrUnknownTLSConfig = errors.New("unknown tls config")
+)
+
+// ConfigError reports the config field or DSN parameter which failed to parse or validate.
+type ConfigError struct {
+	Field string
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("mysql: config field %s: %s", e.Field, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func configError(field string, err error) error {
+	return &ConfigError{Field: field, Err: err}
+}
+
+// Duration is a time.Duration read from strings like "5s" in JSON, YAML and env.
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// TLSOptions describes how to wrap the connection in TLS, see WithProxyTLS.
+// Name refers to a tls.Config registered by RegisterTLSConfig and wins over the other fields,
+// Disabled wins over all of them.
+type TLSOptions struct {
+	Enabled    bool   `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Disabled   bool   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	SkipVerify bool   `json:"skip_verify,omitempty" yaml:"skip_verify,omitempty"`
+	Name       string `json:"name,omitempty" yaml:"name,omitempty"`
+	CA         string `json:"ca,omitempty" yaml:"ca,omitempty"`
+	Cert       string `json:"cert,omitempty" yaml:"cert,omitempty"`
+	Key        string `json:"key,omitempty" yaml:"key,omitempty"`
+	ServerName string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+}
+
+func (t TLSOptions) active() bool {
+	if t.Disabled {
+		return false
+	}
+	return t.Enabled || t.SkipVerify || t.Name != "" || t.CA != "" || t.Cert != ""
+}
+
+// Config holds everything needed to open a DB, see NewFromConfig.
+type Config struct {
+	Network          string            `json:"network,omitempty" yaml:"network,omitempty"`
+	Host             string            `json:"host" yaml:"host"`
+	User             string            `json:"user" yaml:"user"`
+	Passwd           string            `json:"passwd" yaml:"passwd"`
+	DB               string            `json:"db" yaml:"db"`
+	DialTimeout      Duration          `json:"dial_timeout,omitempty" yaml:"dial_timeout,omitempty"`
+	ReadTimeout      Duration          `json:"read_timeout,omitempty" yaml:"read_timeout,omitempty"`
+	WriteTimeout     Duration          `json:"write_timeout,omitempty" yaml:"write_timeout,omitempty"`
+	TLS              TLSOptions        `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Charset          string            `json:"charset,omitempty" yaml:"charset,omitempty"`
+	Collation        string            `json:"collation,omitempty" yaml:"collation,omitempty"`
+	TimeZone         string            `json:"time_zone,omitempty" yaml:"time_zone,omitempty"`
+	SQLMode          string            `json:"sql_mode,omitempty" yaml:"sql_mode,omitempty"`
+	SessionVariables map[string]string `json:"session_variables,omitempty" yaml:"session_variables,omitempty"`
+	InitStatements   []string          `json:"init_statements,omitempty" yaml:"init_statements,omitempty"`
+	Tracing          bool              `json:"tracing,omitempty" yaml:"tracing,omitempty"`
+	Metric           bool              `json:"metric,omitempty" yaml:"metric,omitempty"`
+	Fingerprint      bool              `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+}
+
+// Validate checks the config and returns a *ConfigError naming the first offending field.
+func (c *Config) Validate() error {
+	switch c.Network {
+	case "", "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return configError("network", fmt.Errorf("%w: %q", ErrConfigInvalid, c.Network))
+	}
+	if c.Host == "" {
+		return configError("host", ErrConfigRequired)
+	}
+	if c.User == "" {
+		return configError("user", ErrConfigRequired)
+	}
+	for _, f := range []struct {
+		name  string
+		value Duration
+	}{
+		{"dial_timeout", c.DialTimeout},
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+	} {
+		if f.value < 0 {
+			return configError(f.name, fmt.Errorf("%w: negative duration %s", ErrConfigInvalid, f.value.Duration()))
+		}
+	}
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		if c.TLS.Cert == "" {
+			return configError("tls.cert", ErrConfigRequired)
+		}
+		return configError("tls.key", ErrConfigRequired)
+	}
+	if c.TLS.Name != "" {
+		if _, ok := lookupTLSConfig(c.TLS.Name); !ok {
+			return configError("tls.name", fmt.Errorf("%w: %q", ErrUnknownTLSConfig, c.TLS.Name))
+		}
+	}
+	if c.Charset != "" && !identifierRegexp.MatchString(c.Charset) {
+		return configError("charset", fmt.Errorf("%w: %q", ErrConfigInvalid, c.Charset))
+	}
+	if c.Collation != "" && !identifierRegexp.MatchString(c.Collation) {
+		return configError("collation", fmt.Errorf("%w: %q", ErrConfigInvalid, c.Collation))
+	}
+	for _, name := range c.sessionVariableNames() {
+		if !identifierRegexp.MatchString(name) {
+			return configError(goutil.StringsJoin("session_variables.", name), ErrConfigInvalid)
+		}
+	}
+	return nil
+}
+
+// Options converts the config into options for New.
+func (c *Config) Options() ([]Option, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	options := []Option{
+		WithTracing(c.Tracing),
+		WithMetric(c.Metric),
+	}
+	if c.Fingerprint {
+		options = append(options, EnableFingerprint())
+	}
+	if c.Network != "" {
+		options = append(options, WithNetwork(c.Network))
+	}
+	if c.DialTimeout > 0 {
+		options = append(options, WithDialTimeout(c.DialTimeout.Duration()))
+	}
+	if c.ReadTimeout > 0 {
+		options = append(options, WithReadTimeout(c.ReadTimeout.Duration()))
+	}
+	if c.WriteTimeout > 0 {
+		options = append(options, WithWriteTimeout(c.WriteTimeout.Duration()))
+	}
+	if c.TLS.active() {
+		config, err := c.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, WithProxyTLS(config))
+	}
+	if c.Charset != "" {
+		options = append(options, WithCharset(c.Charset))
+	}
+	if c.Collation != "" {
+		options = append(options, WithCollation(c.Collation))
+	}
+	if c.TimeZone != "" {
+		options = append(options, WithTimeZone(c.TimeZone))
+	}
+	if c.SQLMode != "" {
+		options = append(options, WithSQLMode(c.SQLMode))
+	}
+	for _, name := range c.sessionVariableNames() {
+		options = append(options, WithSessionVariable(name, c.SessionVariables[name]))
+	}
+	if len(c.InitStatements) > 0 {
+		options = append(options, WithInitStatements(c.InitStatements...))
+	}
+	return options, nil
+}
+
+func (c *Config) sessionVariableNames() []string {
+	names := make([]string, 0, len(c.SessionVariables))
+	for name := range c.SessionVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t TLSOptions) config() (*tls.Config, error) {
+	if t.Name != "" {
+		config, ok := lookupTLSConfig(t.Name)
+		if !ok {
+			return nil, configError("tls.name", fmt.Errorf("%w: %q", ErrUnknownTLSConfig, t.Name))
+		}
+		return config, nil
+	}
+	config, err := NewTLSConfig(t.CA, t.Cert, t.Key, t.ServerName)
+	if err != nil {
+		return nil, configError("tls", err)
+	}
+	config.InsecureSkipVerify = t.SkipVerify
+	return config, nil
+}
+
+// LoadConfig reads a config file, the format is chosen by extension: .json, .yaml or .yml.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(Config)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		return nil, fmt.Errorf("mysql: unsupported config format %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadConfigFromEnv reads the config from environment variables named prefix + "_" + field,
+// e.g. MYSQL_HOST, MYSQL_READ_TIMEOUT or MYSQL_TLS_CA. When prefix_DSN is set it is parsed
+// first and the other variables override it.
+func LoadConfigFromEnv(prefix string) (*Config, error) {
+	cfg := new(Config)
+	if dsn, ok := os.LookupEnv(goutil.StringsJoin(prefix, "_DSN")); ok {
+		parsed, err := ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		cfg = parsed
+	}
+	for _, f := range envFields(cfg) {
+		value, ok := os.LookupEnv(goutil.StringsJoin(prefix, "_", strings.ToUpper(strings.ReplaceAll(f.name, ".", "_"))))
+		if !ok {
+			continue
+		}
+		if err := f.set(value); err != nil {
+			return nil, configError(f.name, fmt.Errorf("%w: %w", ErrConfigInvalid, err))
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+type configField struct {
+	name string
+	set  func(string) error
+}
+
+func envFields(cfg *Config) []configField {
+	str := func(p *string) func(string) error {
+		return func(v string) error {
+			*p = v
+			return nil
+		}
+	}
+	boolean := func(p *bool) func(string) error {
+		return func(v string) (err error) {
+			*p, err = strconv.ParseBool(v)
+			return
+		}
+	}
+	duration := func(p *Duration) func(string) error {
+		return func(v string) error {
+			return p.UnmarshalText([]byte(v))
+		}
+	}
+	return []configField{
+		{"network", str(&cfg.Network)},
+		{"host", str(&cfg.Host)},
+		{"user", str(&cfg.User)},
+		{"passwd", str(&cfg.Passwd)},
+		{"db", str(&cfg.DB)},
+		{"dial_timeout", duration(&cfg.DialTimeout)},
+		{"read_timeout", duration(&cfg.ReadTimeout)},
+		{"write_timeout", duration(&cfg.WriteTimeout)},
+		{"tls.enabled", boolean(&cfg.TLS.Enabled)},
+		{"tls.disabled", boolean(&cfg.TLS.Disabled)},
+		{"tls.skip_verify", boolean(&cfg.TLS.SkipVerify)},
+		{"tls.name", str(&cfg.TLS.Name)},
+		{"tls.ca", str(&cfg.TLS.CA)},
+		{"tls.cert", str(&cfg.TLS.Cert)},
+		{"tls.key", str(&cfg.TLS.Key)},
+		{"tls.server_name", str(&cfg.TLS.ServerName)},
+		{"charset", str(&cfg.Charset)},
+		{"collation", str(&cfg.Collation)},
+		{"time_zone", str(&cfg.TimeZone)},
+		{"sql_mode", str(&cfg.SQLMode)},
+		{"tracing", boolean(&cfg.Tracing)},
+		{"metric", boolean(&cfg.Metric)},
+		{"fingerprint", boolean(&cfg.Fingerprint)},
+	}
+}
+
+var tlsConfigs sync.Map
+
+// RegisterTLSConfig registers a custom tls.Config usable as tls=<name> in a DSN.
+func RegisterTLSConfig(name string, config *tls.Config) error {
+	switch strings.ToLower(name) {
+	case "true", "false", "skip-verify", "preferred":
+		return fmt.Errorf("mysql: tls config name %q is reserved", name)
+	}
+	tlsConfigs.Store(name, config)
+	return nil
+}
+
+func DeregisterTLSConfig(name string) {
+	tlsConfigs.Delete(name)
+}
+
+func lookupTLSConfig(name string) (*tls.Config, bool) {
+	if v, ok := tlsConfigs.Load(name); ok {
+		return v.(*tls.Config), true
+	}
+	return nil, false
+}
@@ -0,0 +1,225 @@
+package mysql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/XiBao/goutil"
+	"github.com/ziutek/mymysql/autorc"
+	"github.com/ziutek/mymysql/mysql"
+	"github.com/ziutek/mymysql/native"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+var (
+	CharsetKey   = attribute.Key("db.mysql.charset")
+	CollationKey = attribute.Key("db.mysql.collation")
+	TimeZoneKey  = attribute.Key("db.mysql.time_zone")
+	SQLModeKey   = attribute.Key("db.mysql.sql_mode")
+)
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// NewTLSConfig builds a tls.Config from PEM files. caFile verifies the server certificate,
+// certFile and keyFile are the optional client certificate pair.
+func NewTLSConfig(caFile string, certFile string, keyFile string, serverName string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("mysql: no certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (opt *option) networkOrDefault() string {
+	if opt.network == "" {
+		return DefaultNetwork
+	}
+	return opt.network
+}
+
+func (opt *option) charsetOrDefault() string {
+	if opt.charset == "" {
+		return DefaultCharset
+	}
+	return opt.charset
+}
+
+// setup applies dial settings and registers the init statements on conn,
+// before runs ahead of every dial when not nil and dialed after every successful one,
+// with whether TLS was established.
+func (opt *option) setup(conn *autorc.Conn, before func() error, dialed func(tls bool)) error {
+	if opt.dialTimeout > 0 {
+		conn.SetTimeout(opt.dialTimeout)
+	}
+	if opt.readTimeout > 0 || opt.writeTimeout > 0 || opt.tlsConfig != nil || before != nil || dialed != nil {
+		conn.Raw.SetDialer(opt.dialer(before, dialed))
+	}
+	statements, err := opt.initSQL(conn)
+	if err != nil {
+		return err
+	}
+	for _, sql := range statements {
+		conn.Register(sql)
+	}
+	return nil
+}
+
+func (opt *option) initSQL(conn *autorc.Conn) ([]string, error) {
+	charset := opt.charsetOrDefault()
+	if !identifierRegexp.MatchString(charset) {
+		return nil, fmt.Errorf("mysql: invalid charset %q", charset)
+	}
+	names := goutil.StringsJoin("set names ", charset)
+	if opt.collation != "" {
+		if !identifierRegexp.MatchString(opt.collation) {
+			return nil, fmt.Errorf("mysql: invalid collation %q", opt.collation)
+		}
+		names = goutil.StringsJoin(names, " collate ", opt.collation)
+	}
+	statements := make([]string, 0, len(opt.sessionVars)+len(opt.initStatements)+1)
+	statements = append(statements, names)
+	for _, v := range opt.sessionVars {
+		if !identifierRegexp.MatchString(v.name) {
+			return nil, fmt.Errorf("mysql: invalid session variable %q", v.name)
+		}
+		statements = append(statements, goutil.StringsJoin("set session ", v.name, " = ", goutil.DBQuote(v.value, conn)))
+	}
+	statements = append(statements, opt.initStatements...)
+	return statements, nil
+}
+
+// dialer wraps the native dialer with read/write deadlines and the TLS of WithProxyTLS.
+func (opt *option) dialer(before func() error, dialed func(tls bool)) mysql.Dialer {
+	return func(proto, laddr, raddr string, timeout time.Duration) (net.Conn, error) {
+		if before != nil {
+			if err := before(); err != nil {
+				return nil, err
+			}
+		}
+		conn, err := native.DefaultDialer(proto, laddr, raddr, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if opt.tlsConfig != nil {
+			config := opt.tlsConfig.Clone()
+			if config.ServerName == "" && proto != "unix" {
+				if host, _, err := net.SplitHostPort(raddr); err == nil {
+					config.ServerName = host
+				}
+			}
+			tlsConn := tls.Client(conn, config)
+			if timeout > 0 {
+				tlsConn.SetDeadline(time.Now().Add(timeout))
+			}
+			if err := tlsConn.Handshake(); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			tlsConn.SetDeadline(time.Time{})
+			conn = tlsConn
+		}
+		if dialed != nil {
+			dialed(opt.tlsConfig != nil)
+		}
+		if opt.readTimeout > 0 || opt.writeTimeout > 0 {
+			conn = &deadlineConn{
+				Conn:         conn,
+				readTimeout:  opt.readTimeout,
+				writeTimeout: opt.writeTimeout,
+			}
+		}
+		return conn, nil
+	}
+}
+
+// attributes returns the attributes of both spans and metrics, the ones which may take
+// many values per deployment are left to spanAttributes.
+func (opt *option) attributes() []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 2)
+	if opt.networkOrDefault() == "unix" {
+		attrs = append(attrs, semconv.NetworkTransportUnix)
+	} else {
+		attrs = append(attrs, semconv.NetworkTransportTCP)
+	}
+	if opt.shardID != "" {
+		attrs = append(attrs, ShardIDKey.String(opt.shardID))
+	}
+	return attrs
+}
+
+// spanAttributes returns the attributes describing the connection on spans only.
+func (opt *option) spanAttributes(host string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 6)
+	if opt.networkOrDefault() == "unix" {
+		attrs = append(attrs, semconv.ServerAddress(host))
+	} else if addr, port, err := net.SplitHostPort(host); err == nil {
+		attrs = append(attrs, semconv.ServerAddress(addr))
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, semconv.ServerPort(p))
+		}
+	} else {
+		attrs = append(attrs, semconv.ServerAddress(host))
+	}
+	attrs = append(attrs, CharsetKey.String(opt.charsetOrDefault()))
+	if opt.collation != "" {
+		attrs = append(attrs, CollationKey.String(opt.collation))
+	}
+	for _, v := range opt.sessionVars {
+		switch v.name {
+		case "time_zone":
+			attrs = append(attrs, TimeZoneKey.String(v.value))
+		case "sql_mode":
+			attrs = append(attrs, SQLModeKey.String(v.value))
+		}
+	}
+	return attrs
+}
+
+type deadlineConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.readTimeout > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.writeTimeout > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,103 @@
+package mysql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ziutek/mymysql/autorc"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func newOption(options ...Option) *option {
+	opt := new(option)
+	for _, o := range options {
+		o(opt)
+	}
+	return opt
+}
+
+func TestInitSQL(t *testing.T) {
+	conn := autorc.New("tcp", "", "127.0.0.1:3306", "app", "secret", "orders")
+	opt := newOption(
+		WithCollation("utf8mb4_bin"),
+		WithTimeZone("+08:00"),
+		WithSessionVariable("wait_timeout", "o'clock"),
+		WithInitStatements("set autocommit = 1"),
+	)
+	statements, err := opt.initSQL(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"set names utf8mb4 collate utf8mb4_bin",
+		"set session time_zone = '+08:00'",
+		`set session wait_timeout = 'o\'clock'`,
+		"set autocommit = 1",
+	}, statements)
+
+	_, err = newOption(WithCharset("utf8; drop table t")).initSQL(conn)
+	assert.Error(t, err)
+	_, err = newOption(WithSessionVariable("a = 1, b", "2")).initSQL(conn)
+	assert.Error(t, err)
+}
+
+func TestAttributes(t *testing.T) {
+	opt := newOption(WithTimeZone("UTC"), WithShardID("s1"))
+	attrs := attribute.NewSet(opt.attributes()...)
+	assert.True(t, attrs.HasValue(ShardIDKey))
+	assert.True(t, attrs.HasValue(semconv.NetworkTransportKey))
+	assert.False(t, attrs.HasValue(semconv.ServerAddressKey))
+	assert.False(t, attrs.HasValue(CharsetKey))
+
+	spanAttrs := attribute.NewSet(opt.spanAttributes("db.local:3307")...)
+	addr, _ := spanAttrs.Value(semconv.ServerAddressKey)
+	assert.Equal(t, "db.local", addr.AsString())
+	port, _ := spanAttrs.Value(semconv.ServerPortKey)
+	assert.Equal(t, int64(3307), port.AsInt64())
+	timeZone, _ := spanAttrs.Value(TimeZoneKey)
+	assert.Equal(t, "UTC", timeZone.AsString())
+}
+
+func TestDialerProxyTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	var established []bool
+	dialed := func(tls bool) {
+		established = append(established, tls)
+	}
+	dial := newOption(WithProxyTLS(&tls.Config{RootCAs: pool})).dialer(nil, dialed)
+	conn, err := dial("tcp", "", srv.Listener.Addr().String(), time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true}, established)
+	_, ok := conn.(*tls.Conn)
+	assert.True(t, ok)
+	conn.Close()
+
+	dial = newOption(WithProxyTLS(&tls.Config{})).dialer(nil, dialed)
+	_, err = dial("tcp", "", srv.Listener.Addr().String(), time.Second)
+	assert.Error(t, err)
+	assert.Len(t, established, 1)
+
+	refused := errors.New("refused")
+	dial = newOption().dialer(func() error { return refused }, dialed)
+	_, err = dial("tcp", "", srv.Listener.Addr().String(), time.Second)
+	assert.ErrorIs(t, err, refused)
+}
+
+func TestDeadlineConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := &deadlineConn{Conn: client, readTimeout: 10 * time.Millisecond}
+	_, err := conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
@@ -0,0 +1,172 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/ziutek/mymysql/autorc"
+	"github.com/ziutek/mymysql/mysql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrCredentialsRotated is returned by a dial when the provider hands out credentials
+// different from the ones of the current connection, the DB then reconnects with them.
+var ErrCredentialsRotated = errors.New("mysql: credentials rotated")
+
+const CredentialsRotatedEvent = "db.credentials.rotated"
+
+var (
+	RotateReasonKey       = attribute.Key("db.credentials.rotate_reason")
+	CredentialsChangedKey = attribute.Key("db.credentials.changed")
+)
+
+type Credentials struct {
+	User   string
+	Passwd string
+}
+
+// CredentialProvider returns the credentials used by every (re)connect.
+type CredentialProvider = func(ctx context.Context) (Credentials, error)
+
+// WithCredentialProvider makes the DB ask provider for credentials on every (re)connect
+// instead of reusing the user and passwd given to New.
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(opt *option) {
+		opt.credentialProvider = provider
+	}
+}
+
+// Reconnect drops the current connection and connects again with credentials
+// fetched from the provider, use it to force a rotation.
+func (t *DB) Reconnect(ctx context.Context) error {
+	t.mu.RLock()
+	generation := t.generation
+	t.mu.RUnlock()
+	return t.withSpan(ctx, "db.Reconnect", "", nil,
+		func(ctx context.Context, span trace.Span) error {
+			return t.rotate(ctx, span, generation, "manual")
+		})
+}
+
+func (t *DB) fetchCredentials(ctx context.Context, fallback Credentials) (Credentials, error) {
+	if t.option.credentialProvider == nil {
+		return fallback, nil
+	}
+	return t.option.credentialProvider(ctx)
+}
+
+// connect opens a new connection authenticated with creds.
+func (t *DB) connect(creds Credentials) (*autorc.Conn, error) {
+	conn := autorc.New(t.option.networkOrDefault(), "", t.host, creds.User, creds.Passwd, t.dbName)
+	var before func() error
+	if t.option.credentialProvider != nil {
+		before = t.checkCredentials(creds)
+	}
+	if err := t.option.setup(conn, before, t.tlsEstablished.Store); err != nil {
+		return nil, err
+	}
+	// thrsafe only starts the pinger stopped by Close in Connect
+	err := conn.Raw.Connect()
+	if autorc.IsNetErr(err) {
+		err = conn.Reconnect()
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.credentials.Store(&creds)
+	return conn, nil
+}
+
+// checkCredentials returns the hook run before every dial of a connection made with creds,
+// it refuses the reconnects done by autorc once the provider hands out other credentials.
+// The first dial is not checked, creds were just fetched from the provider.
+func (t *DB) checkCredentials(creds Credentials) func() error {
+	var dialed atomic.Bool
+	return func() error {
+		if !dialed.Swap(true) {
+			return nil
+		}
+		current, err := t.option.credentialProvider(context.Background())
+		if err != nil {
+			return err
+		}
+		if current != creds {
+			return ErrCredentialsRotated
+		}
+		return nil
+	}
+}
+
+// do runs fn on the current connection, when it fails because the credentials are
+// outdated the connection is replaced with fresh credentials and fn runs once more.
+func (t *DB) do(ctx context.Context, span trace.Span, fn func(conn *autorc.Conn) error) error {
+	t.mu.RLock()
+	generation := t.generation
+	err := fn(t.db)
+	t.mu.RUnlock()
+	if err == nil || t.option.credentialProvider == nil || !isCredentialError(err) {
+		return err
+	}
+	reason := "auth_failed"
+	if errors.Is(err, ErrCredentialsRotated) {
+		reason = "provider_changed"
+	}
+	if err := t.rotate(ctx, span, generation, reason); err != nil {
+		return err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return fn(t.db)
+}
+
+// rotate replaces the connection of the given generation, concurrent callers which saw
+// the same generation wait for the first one and reuse its connection.
+func (t *DB) rotate(ctx context.Context, span trace.Span, generation uint64, reason string) error {
+	t.rotateMu.Lock()
+	defer t.rotateMu.Unlock()
+	t.mu.RLock()
+	current := t.generation
+	t.mu.RUnlock()
+	if current != generation {
+		return nil
+	}
+	previous := t.credentials.Load()
+	creds, err := t.fetchCredentials(ctx, *previous)
+	if err != nil {
+		return err
+	}
+	conn, err := t.connect(creds)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	old := t.db
+	t.db = conn
+	t.generation++
+	t.mu.Unlock()
+	old.Raw.Close()
+	if span != nil && span.IsRecording() {
+		span.AddEvent(CredentialsRotatedEvent, trace.WithAttributes(
+			RotateReasonKey.String(reason),
+			CredentialsChangedKey.Bool(previous.User != creds.User || previous.Passwd != creds.Passwd),
+		))
+	}
+	return nil
+}
+
+func isCredentialError(err error) bool {
+	if errors.Is(err, ErrCredentialsRotated) || errors.Is(err, mysql.ErrAuthentication) {
+		return true
+	}
+	var pErr *mysql.Error
+	if errors.As(err, &pErr) {
+		return pErr.Code == mysql.ER_ACCESS_DENIED_ERROR
+	}
+	var vErr mysql.Error
+	if errors.As(err, &vErr) {
+		return vErr.Code == mysql.ER_ACCESS_DENIED_ERROR
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package mysql_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/XiBao/db/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	mu    sync.Mutex
+	creds mysql.Credentials
+	calls int
+}
+
+func (p *fakeProvider) Get(ctx context.Context) (mysql.Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	return p.creds, nil
+}
+
+func (p *fakeProvider) Set(creds mysql.Credentials) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.creds = creds
+}
+
+func (p *fakeProvider) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func TestCredentialRotation(t *testing.T) {
+	srv := newFakeServer(t, "app", "v1")
+	provider := &fakeProvider{creds: mysql.Credentials{User: "app", Passwd: "v1"}}
+	ctx := context.Background()
+	db, err := mysql.New(ctx, srv.Addr(), "", "", "orders", mysql.WithCredentialProvider(provider.Get))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close(ctx)
+	assert.Equal(t, 1, provider.Calls())
+
+	// a forced rotation fetches the credentials once and connects with them
+	srv.SetPasswd("v2")
+	provider.Set(mysql.Credentials{User: "app", Passwd: "v2"})
+	assert.NoError(t, db.Reconnect(ctx))
+	assert.Equal(t, 2, provider.Calls())
+	assert.Equal(t, 2, srv.Logins())
+	_, _, err = db.QueryCtx(ctx, "update orders set state = 1")
+	assert.NoError(t, err)
+
+	// the reconnect of the dropped connection sees the new credentials and rotates
+	srv.SetPasswd("v3")
+	provider.Set(mysql.Credentials{User: "app", Passwd: "v3"})
+	srv.Disconnect()
+	_, _, err = db.QueryCtx(ctx, "update orders set state = 2")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, srv.Logins())
+	// checked by the refused dial, fetched by the rotation
+	assert.Equal(t, 4, provider.Calls())
+
+	// a reconnect with unchanged credentials is not refused
+	srv.Disconnect()
+	_, _, err = db.QueryCtx(ctx, "update orders set state = 3")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, srv.Logins())
+	assert.Equal(t, 5, provider.Calls())
+}
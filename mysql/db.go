@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/XiBao/goutil"
@@ -25,6 +27,15 @@ var instrumName = goutil.StringsJoin(db.InstrumName, "/mysql")
 
 type DB struct {
 	db             *autorc.Conn
+	mu             sync.RWMutex
+	rotateMu       sync.Mutex
+	generation     uint64
+	host           string
+	dbName         string
+	shardID        string
+	credentials    atomic.Pointer[Credentials]
+	tlsEstablished atomic.Bool
+	cache          *queryCache
 	option         *option
 	traceProvider  trace.TracerProvider
 	tracer         trace.Tracer //nolint:structcheck
@@ -32,10 +43,13 @@ type DB struct {
 	meter          metric.Meter
 	queryHistogram metric.Int64Histogram
 	attrs          []attribute.KeyValue
+	spanAttrs      []attribute.KeyValue
 }
 
 func New(ctx context.Context, host, user, passwd, db string, options ...Option) (*DB, error) {
 	ret := &DB{
+		host:          host,
+		dbName:        db,
 		option:        new(option),
 		traceProvider: otel.GetTracerProvider(),
 		meterProvider: otel.GetMeterProvider(),
@@ -47,6 +61,9 @@ func New(ctx context.Context, host, user, passwd, db string, options ...Option)
 	for _, opt := range options {
 		opt(ret.option)
 	}
+	ret.shardID = ret.option.shardID
+	ret.attrs = append(ret.attrs, ret.option.attributes()...)
+	ret.spanAttrs = ret.option.spanAttributes(host)
 	ret.tracer = ret.traceProvider.Tracer(instrumName)
 	ret.meter = ret.meterProvider.Meter(instrumName)
 	var err error
@@ -58,12 +75,23 @@ func New(ctx context.Context, host, user, passwd, db string, options ...Option)
 	if err != nil {
 		return nil, err
 	}
-	mysql := autorc.New("tcp", "", host, user, passwd, db)
-	mysql.Register("set names utf8mb4")
-	ret.db = mysql
+	if ret.option.cacheStore != nil {
+		if ret.cache, err = newQueryCache(ret); err != nil {
+			return nil, err
+		}
+	}
 	if err = ret.withSpan(ctx, "db.Connect", "", nil,
 		func(ctx context.Context, span trace.Span) error {
-			return mysql.Reconnect()
+			creds, err := ret.fetchCredentials(ctx, Credentials{User: user, Passwd: passwd})
+			if err != nil {
+				return err
+			}
+			mysql, err := ret.connect(creds)
+			if err != nil {
+				return err
+			}
+			ret.db = mysql
+			return nil
 		}); err != nil {
 		return nil, err
 	}
@@ -103,8 +131,10 @@ func (t *DB) withSpan(
 		startTime = time.Now()
 	}
 	if t.TracingEnabled() {
-		attrs := make([]attribute.KeyValue, 0, len(t.attrs)+1)
+		attrs := make([]attribute.KeyValue, 0, len(t.attrs)+len(t.spanAttrs)+3)
 		attrs = append(attrs, t.attrs...)
+		attrs = append(attrs, t.spanAttrs...)
+		attrs = append(attrs, semconv.TLSEstablished(t.tlsEstablished.Load()))
 		if sql != "" {
 			attrs = append(attrs, semconv10.DBStatementKey.String(t.formatQuery(sql)))
 			query := sql
@@ -137,7 +167,8 @@ func (t *DB) withSpan(
 func (t *DB) Query(sql string, params ...interface{}) (rows []mysql.Row, res mysql.Result, err error) {
 	err = t.withSpan(context.TODO(), "db.Query", sql, params,
 		func(ctx context.Context, span trace.Span) error {
-			rows, res, err = t.db.Query(sql, params...)
+			var err error
+			rows, res, err = t.query(ctx, span, false, sql, params)
 			if err != nil {
 				return err
 			}
@@ -152,7 +183,8 @@ func (t *DB) Query(sql string, params ...interface{}) (rows []mysql.Row, res mys
 func (t *DB) QueryCtx(ctx context.Context, sql string, params ...interface{}) (rows []mysql.Row, res mysql.Result, err error) {
 	err = t.withSpan(ctx, "db.Query", sql, params,
 		func(ctx context.Context, span trace.Span) error {
-			rows, res, err = t.db.Query(sql, params...)
+			var err error
+			rows, res, err = t.query(ctx, span, false, sql, params)
 			if err != nil {
 				return err
 			}
@@ -167,10 +199,14 @@ func (t *DB) QueryCtx(ctx context.Context, sql string, params ...interface{}) (r
 func (t *DB) QueryFirst(sql string, params ...interface{}) (row mysql.Row, res mysql.Result, err error) {
 	err = t.withSpan(context.TODO(), "db.Query", sql, params,
 		func(ctx context.Context, span trace.Span) error {
-			row, res, err = t.db.QueryFirst(sql, params...)
+			rows, r, err := t.query(ctx, span, true, sql, params)
 			if err != nil {
 				return err
 			}
+			if len(rows) > 0 {
+				row = rows[0]
+			}
+			res = r
 			if span != nil && span.IsRecording() {
 				span.SetAttributes(db.RowsAffected.Int64(int64(res.AffectedRows())))
 			}
@@ -182,10 +218,14 @@ func (t *DB) QueryFirst(sql string, params ...interface{}) (row mysql.Row, res m
 func (t *DB) QueryFirstCtx(ctx context.Context, sql string, params ...interface{}) (row mysql.Row, res mysql.Result, err error) {
 	err = t.withSpan(ctx, "db.Query", sql, params,
 		func(ctx context.Context, span trace.Span) error {
-			row, res, err = t.db.QueryFirst(sql, params...)
+			rows, r, err := t.query(ctx, span, true, sql, params)
 			if err != nil {
 				return err
 			}
+			if len(rows) > 0 {
+				row = rows[0]
+			}
+			res = r
 			if span != nil && span.IsRecording() {
 				span.SetAttributes(db.RowsAffected.Int64(int64(res.AffectedRows())))
 			}
@@ -194,10 +234,28 @@ func (t *DB) QueryFirstCtx(ctx context.Context, sql string, params ...interface{
 	return
 }
 
+// ShardID returns the shard id set by WithShardID or Router.Add.
+func (t *DB) ShardID() string {
+	return t.shardID
+}
+
+func (t *DB) Close(ctx context.Context) error {
+	return t.withSpan(ctx, "db.Close", "", nil,
+		func(ctx context.Context, span trace.Span) error {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			return t.db.Raw.Close()
+		})
+}
+
 func (t *DB) Quote(str string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return goutil.DBQuote(str, t.db)
 }
 
 func (t *DB) Escape(str string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.db.Escape(str)
 }
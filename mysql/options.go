@@ -1,11 +1,40 @@
 package mysql
 
-import "github.com/XiBao/db/query"
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/XiBao/db/query"
+)
+
+const (
+	DefaultNetwork = "tcp"
+	DefaultCharset = "utf8mb4"
+)
 
 type option struct {
 	enableTracing  bool
 	enableMetric   bool
 	queryFormatter func(query string) string
+	network        string
+	dialTimeout    time.Duration
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	tlsConfig      *tls.Config
+	charset        string
+	collation      string
+	initStatements []string
+	sessionVars    []sessionVar
+	shardID        string
+	cacheStore     CacheStore
+	cacheTTL       time.Duration
+
+	credentialProvider CredentialProvider
+}
+
+type sessionVar struct {
+	name  string
+	value string
 }
 
 type Option = func(opt *option)
@@ -33,3 +62,91 @@ func EnableFingerprint() Option {
 		opt.queryFormatter = query.Fingerprint
 	}
 }
+
+// WithNetwork sets the network used to reach the server, "tcp" (default), "tcp4", "tcp6" or "unix".
+// When network is "unix" the host argument of New is the socket path.
+func WithNetwork(network string) Option {
+	return func(opt *option) {
+		opt.network = network
+	}
+}
+
+// WithDialTimeout sets the timeout for connect and reconnect.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(opt *option) {
+		opt.dialTimeout = timeout
+	}
+}
+
+// WithReadTimeout sets the deadline applied to every read from the server.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(opt *option) {
+		opt.readTimeout = timeout
+	}
+}
+
+// WithWriteTimeout sets the deadline applied to every write to the server.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(opt *option) {
+		opt.writeTimeout = timeout
+	}
+}
+
+// WithProxyTLS wraps the connection in TLS right after dialing, see NewTLSConfig.
+// mymysql does not implement the SSL negotiation of the MySQL protocol, so the endpoint
+// must accept TLS directly, as the TLS-terminating proxies of managed MySQL services do.
+// A MySQL server with its own SSL setup fails the handshake.
+func WithProxyTLS(config *tls.Config) Option {
+	return func(opt *option) {
+		opt.tlsConfig = config
+	}
+}
+
+// WithCharset sets the connection charset, default utf8mb4.
+func WithCharset(charset string) Option {
+	return func(opt *option) {
+		opt.charset = charset
+	}
+}
+
+// WithCollation sets the connection collation, it must be valid for the charset.
+func WithCollation(collation string) Option {
+	return func(opt *option) {
+		opt.collation = collation
+	}
+}
+
+// WithInitStatements registers statements executed after every (re)connect.
+func WithInitStatements(statements ...string) Option {
+	return func(opt *option) {
+		opt.initStatements = append(opt.initStatements, statements...)
+	}
+}
+
+// WithSessionVariable sets a session variable after every (re)connect.
+func WithSessionVariable(name string, value string) Option {
+	return func(opt *option) {
+		for idx, v := range opt.sessionVars {
+			if v.name == name {
+				opt.sessionVars[idx].value = value
+				return
+			}
+		}
+		opt.sessionVars = append(opt.sessionVars, sessionVar{name: name, value: value})
+	}
+}
+
+func WithTimeZone(timeZone string) Option {
+	return WithSessionVariable("time_zone", timeZone)
+}
+
+func WithSQLMode(sqlMode string) Option {
+	return WithSessionVariable("sql_mode", sqlMode)
+}
+
+// WithShardID tags spans and metrics of the DB with the shard id, see Router.
+func WithShardID(id string) Option {
+	return func(opt *option) {
+		opt.shardID = id
+	}
+}
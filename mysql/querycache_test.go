@@ -0,0 +1,129 @@
+package mysql_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/XiBao/db/model"
+	"github.com/XiBao/db/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+// memCacheStore is a CacheStore with a clock the tests move forward.
+type memCacheStore struct {
+	mu      sync.Mutex
+	now     time.Time
+	entries map[string]memCacheEntry
+}
+
+type memCacheEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func newMemCacheStore() *memCacheStore {
+	return &memCacheStore{now: time.Unix(1700000000, 0), entries: make(map[string]memCacheEntry)}
+}
+
+func (s *memCacheStore) Get(ctx context.Context, key []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[string(key)]
+	if !ok || !entry.expiresAt.IsZero() && !s.now.Before(entry.expiresAt) {
+		return nil, model.ErrNotFound
+	}
+	return entry.value, nil
+}
+
+func (s *memCacheStore) Set(ctx context.Context, key []byte, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := memCacheEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = s.now.Add(ttl)
+	}
+	s.entries[string(key)] = entry
+	return nil
+}
+
+func (s *memCacheStore) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+func TestQueryCache(t *testing.T) {
+	srv := newFakeServer(t, "app", "secret")
+	srv.SetResults(func(sql string) *fakeResult {
+		if strings.HasPrefix(strings.ToLower(sql), "select") {
+			return &fakeResult{Columns: []string{"id", "state"}, Rows: [][]string{{"1", "new"}}}
+		}
+		return &fakeResult{AffectedRows: 1}
+	})
+	store := newMemCacheStore()
+	ctx := context.Background()
+	db, err := mysql.New(ctx, srv.Addr(), "app", "secret", "shop", mysql.WithCache(store, time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close(ctx)
+
+	sent := func() int {
+		var n int
+		for _, sql := range srv.Queries() {
+			if !strings.HasPrefix(sql, "set ") {
+				n++
+			}
+		}
+		return n
+	}
+	run := func(sql string) {
+		t.Helper()
+		rows, _, err := db.QueryCtx(ctx, sql)
+		assert.NoError(t, err)
+		if strings.HasPrefix(sql, "select * from orders") {
+			assert.Len(t, rows, 1)
+		}
+	}
+
+	run("select * from orders where id = 1")
+	run("select * from orders where id = 1")
+	assert.Equal(t, 1, sent())
+
+	// a write through the DB invalidates the table
+	run("update orders set state = 'paid' where id = 1")
+	run("select * from orders where id = 1")
+	assert.Equal(t, 3, sent())
+	run("select * from orders where id = 1")
+	assert.Equal(t, 3, sent())
+
+	// as does InvalidateCache for writes made elsewhere
+	assert.NoError(t, db.InvalidateCache(ctx, "Orders"))
+	run("select * from orders where id = 1")
+	assert.Equal(t, 4, sent())
+
+	// results expire after the ttl
+	store.Advance(time.Minute)
+	run("select * from orders where id = 1")
+	assert.Equal(t, 5, sent())
+	run("select * from orders where id = 1")
+	assert.Equal(t, 5, sent())
+
+	// locking, non deterministic and table-less selects are never cached
+	for _, sql := range []string{
+		"select * from orders where id = 1 for update",
+		"select * from orders where created_at < now()",
+		"select last_insert_id()",
+	} {
+		run(sql)
+		run(sql)
+	}
+	assert.Equal(t, 11, sent())
+
+	_, _, err = db.QueryCtx(mysql.SkipCache(ctx), "select * from orders where id = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 12, sent())
+}
@@ -0,0 +1,266 @@
+package mysql_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer speaks enough of the MySQL protocol for mymysql: mysql_native_password
+// authentication, COM_QUERY answered by results, COM_PING and COM_QUIT.
+type fakeServer struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	user    string
+	passwd  string
+	queries []string
+	logins  int
+	conns   map[net.Conn]struct{}
+	results func(sql string) *fakeResult
+}
+
+// fakeResult is a result set of string columns, an OK packet without Columns
+// or an error packet with Err.
+type fakeResult struct {
+	Columns      []string
+	Rows         [][]string
+	AffectedRows uint64
+	Err          string
+}
+
+func newFakeServer(t *testing.T, user string, passwd string) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, user: user, passwd: passwd, conns: make(map[net.Conn]struct{})}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeServer) SetPasswd(passwd string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passwd = passwd
+}
+
+func (s *fakeServer) SetResults(fn func(sql string) *fakeResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = fn
+}
+
+// Queries returns the queries received so far, init statements included.
+func (s *fakeServer) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+// Disconnect drops every open connection, as a restarted server would.
+func (s *fakeServer) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *fakeServer) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+type fakeConn struct {
+	rw  *bufio.ReadWriter
+	seq byte
+}
+
+func (c *fakeConn) read() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.rw, header[:]); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return nil, err
+	}
+	c.seq = header[3] + 1
+	return payload, nil
+}
+
+func (c *fakeConn) write(payload []byte) {
+	n := len(payload)
+	c.rw.Write([]byte{byte(n), byte(n >> 8), byte(n >> 16), c.seq})
+	c.rw.Write(payload)
+	c.seq++
+}
+
+func (c *fakeConn) ok(affectedRows uint64) {
+	payload := []byte{0}
+	payload = appendLenEnc(payload, affectedRows)
+	payload = append(payload, 0, 2, 0, 0, 0)
+	c.write(payload)
+}
+
+func (c *fakeConn) err(code uint16, msg string) {
+	payload := binary.LittleEndian.AppendUint16([]byte{0xff}, code)
+	payload = append(payload, "#28000"...)
+	c.write(append(payload, msg...))
+}
+
+func (c *fakeConn) eof() {
+	c.write([]byte{0xfe, 0, 0, 2, 0})
+}
+
+func (s *fakeServer) serve(netConn net.Conn) {
+	defer func() {
+		netConn.Close()
+		s.mu.Lock()
+		delete(s.conns, netConn)
+		s.mu.Unlock()
+	}()
+	c := &fakeConn{rw: bufio.NewReadWriter(bufio.NewReader(netConn), bufio.NewWriter(netConn))}
+	scramble := []byte("abcdefghijklmnopqrst")
+
+	greeting := append([]byte{10}, "8.0.0-fake\x00"...)
+	greeting = append(greeting, 1, 0, 0, 0)
+	greeting = append(greeting, scramble[:8]...)
+	greeting = append(greeting, 0)
+	// protocol 41, secure connection, long password and flag, connect with db, transactions
+	greeting = binary.LittleEndian.AppendUint16(greeting, 0x0200|0x8000|0x0001|0x0004|0x0008|0x2000)
+	greeting = append(greeting, 45)
+	greeting = binary.LittleEndian.AppendUint16(greeting, 2)
+	greeting = append(greeting, make([]byte, 13)...)
+	greeting = append(greeting, scramble[8:]...)
+	greeting = append(greeting, 0)
+	c.write(greeting)
+	c.rw.Flush()
+
+	auth, err := c.read()
+	if err != nil || len(auth) < 32 {
+		return
+	}
+	rest := auth[32:]
+	user, rest, _ := bytes.Cut(rest, []byte{0})
+	token := rest[1 : 1+int(rest[0])]
+	s.mu.Lock()
+	accepted := string(user) == s.user && bytes.Equal(token, nativePasswd(s.passwd, scramble))
+	if accepted {
+		s.logins++
+	}
+	s.mu.Unlock()
+	if !accepted {
+		c.err(1045, "Access denied for user")
+		c.rw.Flush()
+		return
+	}
+	c.ok(0)
+	c.rw.Flush()
+
+	for {
+		packet, err := c.read()
+		if err != nil || len(packet) == 0 {
+			return
+		}
+		switch packet[0] {
+		case 0x01: // COM_QUIT
+			return
+		case 0x0e: // COM_PING
+			c.ok(0)
+		case 0x03: // COM_QUERY
+			sql := string(packet[1:])
+			s.mu.Lock()
+			s.queries = append(s.queries, sql)
+			results := s.results
+			s.mu.Unlock()
+			var res *fakeResult
+			if results != nil && !strings.HasPrefix(sql, "set ") {
+				res = results(sql)
+			}
+			if res != nil && res.Err != "" {
+				c.err(1146, res.Err)
+				break
+			}
+			if res == nil || res.Columns == nil {
+				var affected uint64
+				if res != nil {
+					affected = res.AffectedRows
+				}
+				c.ok(affected)
+				break
+			}
+			c.write(appendLenEnc(nil, uint64(len(res.Columns))))
+			for _, name := range res.Columns {
+				var def []byte
+				for _, v := range []string{"def", "", "t", "t", name, name} {
+					def = appendLenEncString(def, v)
+				}
+				def = append(def, 0x0c, 45, 0)
+				def = binary.LittleEndian.AppendUint32(def, 255)
+				def = append(def, 0xfd, 0, 0, 0, 0, 0)
+				c.write(def)
+			}
+			c.eof()
+			for _, row := range res.Rows {
+				var data []byte
+				for _, v := range row {
+					data = appendLenEncString(data, v)
+				}
+				c.write(data)
+			}
+			c.eof()
+		default:
+			c.err(1047, "Unknown command")
+		}
+		c.rw.Flush()
+	}
+}
+
+func nativePasswd(passwd string, scramble []byte) []byte {
+	if passwd == "" {
+		return []byte{}
+	}
+	stage1 := sha1.Sum([]byte(passwd))
+	stage2 := sha1.Sum(stage1[:])
+	stage3 := sha1.Sum(append(append([]byte(nil), scramble...), stage2[:]...))
+	out := make([]byte, len(stage1))
+	for i := range out {
+		out[i] = stage1[i] ^ stage3[i]
+	}
+	return out
+}
+
+func appendLenEnc(b []byte, n uint64) []byte {
+	if n < 251 {
+		return append(b, byte(n))
+	}
+	return binary.LittleEndian.AppendUint64(append(b, 0xfe), n)
+}
+
+func appendLenEncString(b []byte, s string) []byte {
+	return append(appendLenEnc(b, uint64(len(s))), s...)
+}
@@ -0,0 +1,273 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/XiBao/goutil"
+	"github.com/ziutek/mymysql/mysql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ShardIDKey    = attribute.Key("db.shard.id")
+	ShardCountKey = attribute.Key("db.shard.count")
+)
+
+var (
+	ErrNoShards     = errors.New("mysql: router has no shards")
+	ErrUnknownShard = errors.New("mysql: unknown shard")
+	// ErrShardMismatch is returned by Router.Add for a DB not opened WithShardID(id).
+	ErrShardMismatch = errors.New("mysql: shard id mismatch")
+)
+
+// ShardResolver maps a sharding key to a shard id, any lookup function can be used.
+type ShardResolver = func(ctx context.Context, key string) (string, error)
+
+// HashModResolver picks shards[xxhash(key) % len(shards)].
+func HashModResolver(shards ...string) ShardResolver {
+	return func(ctx context.Context, key string) (string, error) {
+		if len(shards) == 0 {
+			return "", ErrNoShards
+		}
+		return shards[goutil.StringToUint64(key)%uint64(len(shards))], nil
+	}
+}
+
+// ShardRange assigns the numeric keys in [Min, Max] to Shard.
+type ShardRange struct {
+	Shard string
+	Min   int64
+	Max   int64
+}
+
+// RangeResolver looks a numeric key up in a range table.
+func RangeResolver(ranges ...ShardRange) ShardResolver {
+	sorted := make([]ShardRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Min < sorted[j].Min
+	})
+	return func(ctx context.Context, key string) (string, error) {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		idx := sort.Search(len(sorted), func(i int) bool {
+			return sorted[i].Max >= id
+		})
+		if idx == len(sorted) || sorted[idx].Min > id {
+			return "", fmt.Errorf("%w: no range contains %d", ErrUnknownShard, id)
+		}
+		return sorted[idx].Shard, nil
+	}
+}
+
+// ShardError is the error of one shard of a fan-out query.
+type ShardError struct {
+	Shard string
+	Err   error
+}
+
+func (e *ShardError) Error() string {
+	return goutil.StringsJoin("shard ", e.Shard, ": ", e.Err.Error())
+}
+
+func (e *ShardError) Unwrap() error {
+	return e.Err
+}
+
+type ShardResult struct {
+	Shard string
+	Rows  []mysql.Row
+	Res   mysql.Result
+	Err   error
+}
+
+type FanOutResult struct {
+	Shards []ShardResult
+}
+
+// Rows merges the rows of the successful shards in shard order.
+func (r FanOutResult) Rows() []mysql.Row {
+	var size int
+	for _, s := range r.Shards {
+		size += len(s.Rows)
+	}
+	rows := make([]mysql.Row, 0, size)
+	for _, s := range r.Shards {
+		if s.Err == nil {
+			rows = append(rows, s.Rows...)
+		}
+	}
+	return rows
+}
+
+// Err joins the *ShardError of every failed shard.
+func (r FanOutResult) Err() error {
+	var errs []error
+	for _, s := range r.Shards {
+		if s.Err != nil {
+			errs = append(errs, &ShardError{Shard: s.Shard, Err: s.Err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Router owns one DB per shard and routes queries by sharding key.
+type Router struct {
+	mu       sync.RWMutex
+	shards   map[string]*DB
+	ids      []string
+	resolver ShardResolver
+	option   *option
+	tracer   trace.Tracer
+}
+
+// NewRouter creates a Router, only the tracing option applies to the router itself.
+func NewRouter(resolver ShardResolver, options ...Option) *Router {
+	ret := &Router{
+		shards:   make(map[string]*DB),
+		resolver: resolver,
+		option:   new(option),
+		tracer:   otel.GetTracerProvider().Tracer(instrumName),
+	}
+	for _, opt := range options {
+		opt(ret.option)
+	}
+	return ret
+}
+
+// Open connects a new DB for shard id, see New.
+func (r *Router) Open(ctx context.Context, id string, host, user, passwd, db string, options ...Option) (*DB, error) {
+	conn, err := New(ctx, host, user, passwd, db, append(options, WithShardID(id))...)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Add(id, conn); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Add registers an already opened DB as shard id. The DB must have been opened
+// WithShardID(id), its spans and metrics are tagged from New on.
+func (r *Router) Add(id string, db *DB) error {
+	if db.shardID != id {
+		return fmt.Errorf("%w: %q added as %q", ErrShardMismatch, db.shardID, id)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.shards[id]; !ok {
+		r.ids = append(r.ids, id)
+		sort.Strings(r.ids)
+	}
+	r.shards[id] = db
+	return nil
+}
+
+// Shards returns the shard ids in sorted order.
+func (r *Router) Shards() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.ids...)
+}
+
+// ShardDB returns the DB of shard id.
+func (r *Router) ShardDB(id string) (*DB, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	db, ok := r.shards[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownShard, id)
+	}
+	return db, nil
+}
+
+// Resolve returns the DB owning key.
+func (r *Router) Resolve(ctx context.Context, key string) (*DB, error) {
+	id, err := r.resolver(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return r.ShardDB(id)
+}
+
+func (r *Router) QueryCtx(ctx context.Context, key string, sql string, params ...interface{}) ([]mysql.Row, mysql.Result, error) {
+	db, err := r.Resolve(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db.QueryCtx(ctx, sql, params...)
+}
+
+func (r *Router) QueryFirstCtx(ctx context.Context, key string, sql string, params ...interface{}) (mysql.Row, mysql.Result, error) {
+	db, err := r.Resolve(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db.QueryFirstCtx(ctx, sql, params...)
+}
+
+// FanOut runs the query on every shard concurrently. The result is always complete,
+// the returned error joins the *ShardError of the failed shards.
+func (r *Router) FanOut(ctx context.Context, sql string, params ...interface{}) (FanOutResult, error) {
+	r.mu.RLock()
+	ids := append([]string(nil), r.ids...)
+	dbs := make([]*DB, len(ids))
+	for idx, id := range ids {
+		dbs[idx] = r.shards[id]
+	}
+	r.mu.RUnlock()
+
+	var span trace.Span
+	if r.option.enableTracing {
+		ctx, span = r.tracer.Start(ctx, "db.FanOut",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(ShardCountKey.Int(len(ids))))
+		defer span.End()
+	}
+
+	result := FanOutResult{Shards: make([]ShardResult, len(ids))}
+	var wg sync.WaitGroup
+	for idx, id := range ids {
+		wg.Add(1)
+		go func(idx int, id string, db *DB) {
+			defer wg.Done()
+			rows, res, err := db.QueryCtx(ctx, sql, params...)
+			result.Shards[idx] = ShardResult{Shard: id, Rows: rows, Res: res, Err: err}
+		}(idx, id, dbs[idx])
+	}
+	wg.Wait()
+
+	err := result.Err()
+	if span != nil && span.IsRecording() && err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if len(ids) == 0 {
+		return result, ErrNoShards
+	}
+	return result, err
+}
+
+// Close closes every shard.
+func (r *Router) Close(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for _, id := range r.ids {
+		if err := r.shards[id].Close(ctx); err != nil {
+			errs = append(errs, &ShardError{Shard: id, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,131 @@
+package mysql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/XiBao/db/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashModResolver(t *testing.T) {
+	resolve := mysql.HashModResolver("s0", "s1", "s2")
+	ctx := context.Background()
+	first, err := resolve(ctx, "customer-42")
+	assert.NoError(t, err)
+	again, _ := resolve(ctx, "customer-42")
+	assert.Equal(t, first, again)
+	assert.Contains(t, []string{"s0", "s1", "s2"}, first)
+
+	_, err = mysql.HashModResolver()(ctx, "customer-42")
+	assert.ErrorIs(t, err, mysql.ErrNoShards)
+}
+
+func TestRangeResolver(t *testing.T) {
+	resolve := mysql.RangeResolver(
+		mysql.ShardRange{Shard: "s1", Min: 1000, Max: 1999},
+		mysql.ShardRange{Shard: "s0", Min: 0, Max: 999},
+	)
+	ctx := context.Background()
+	shard, err := resolve(ctx, "999")
+	assert.NoError(t, err)
+	assert.Equal(t, "s0", shard)
+	shard, err = resolve(ctx, "1000")
+	assert.NoError(t, err)
+	assert.Equal(t, "s1", shard)
+	_, err = resolve(ctx, "2000")
+	assert.ErrorIs(t, err, mysql.ErrUnknownShard)
+	_, err = resolve(ctx, "abc")
+	assert.Error(t, err)
+}
+
+func TestRouterAdd(t *testing.T) {
+	srv := newFakeServer(t, "app", "secret")
+	ctx := context.Background()
+	router := mysql.NewRouter(mysql.HashModResolver("s0"))
+	db, err := mysql.New(ctx, srv.Addr(), "app", "secret", "orders", mysql.WithShardID("s0"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close(ctx)
+	assert.ErrorIs(t, router.Add("s1", db), mysql.ErrShardMismatch)
+	assert.Empty(t, router.Shards())
+	assert.NoError(t, router.Add("s0", db))
+	assert.Equal(t, []string{"s0"}, router.Shards())
+
+	plain, err := mysql.New(ctx, srv.Addr(), "app", "secret", "orders")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer plain.Close(ctx)
+	assert.ErrorIs(t, router.Add("s0", plain), mysql.ErrShardMismatch)
+	assert.Equal(t, "", plain.ShardID())
+}
+
+func openShards(t *testing.T, router *mysql.Router, results map[string]*fakeResult) {
+	ctx := context.Background()
+	for id, res := range results {
+		srv := newFakeServer(t, "app", "secret")
+		srv.SetResults(func(sql string) *fakeResult { return res })
+		db, err := router.Open(ctx, id, srv.Addr(), "app", "secret", "orders")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close(ctx) })
+	}
+}
+
+func TestRouterFanOut(t *testing.T) {
+	router := mysql.NewRouter(mysql.HashModResolver("s0", "s1", "s2"))
+	openShards(t, router, map[string]*fakeResult{
+		"s2": {Columns: []string{"id"}, Rows: [][]string{{"5"}}},
+		"s0": {Columns: []string{"id"}, Rows: [][]string{{"1"}, {"2"}}},
+		"s1": {Columns: []string{"id"}},
+	})
+	result, err := router.FanOut(context.Background(), "select id from orders")
+	assert.NoError(t, err)
+	var ids []string
+	for _, row := range result.Rows() {
+		ids = append(ids, row.Str(0))
+	}
+	assert.Equal(t, []string{"1", "2", "5"}, ids)
+	if assert.Len(t, result.Shards, 3) {
+		assert.Equal(t, "s0", result.Shards[0].Shard)
+		assert.Equal(t, "s1", result.Shards[1].Shard)
+		assert.Empty(t, result.Shards[1].Rows)
+		assert.Equal(t, "s2", result.Shards[2].Shard)
+	}
+}
+
+func TestRouterFanOutShardErrors(t *testing.T) {
+	router := mysql.NewRouter(mysql.HashModResolver("s0", "s1", "s2"))
+	openShards(t, router, map[string]*fakeResult{
+		"s0": {Columns: []string{"id"}, Rows: [][]string{{"1"}}},
+		"s1": {Err: "Table 'orders_1' doesn't exist"},
+		"s2": {Err: "Table 'orders_2' doesn't exist"},
+	})
+	result, err := router.FanOut(context.Background(), "select id from orders")
+	assert.Error(t, err)
+	var shardErr *mysql.ShardError
+	if assert.ErrorAs(t, err, &shardErr) {
+		assert.Equal(t, "s1", shardErr.Shard)
+	}
+	assert.Contains(t, err.Error(), "shard s1: ")
+	assert.Contains(t, err.Error(), "shard s2: ")
+	assert.NotContains(t, err.Error(), "shard s0")
+
+	// the rows of the healthy shards are still returned
+	if assert.Len(t, result.Rows(), 1) {
+		assert.Equal(t, "1", result.Rows()[0].Str(0))
+	}
+	assert.NoError(t, result.Shards[0].Err)
+	assert.Error(t, result.Shards[1].Err)
+	assert.Error(t, result.Shards[2].Err)
+}
+
+func TestRouterFanOutNoShards(t *testing.T) {
+	router := mysql.NewRouter(mysql.HashModResolver())
+	result, err := router.FanOut(context.Background(), "select 1")
+	assert.ErrorIs(t, err, mysql.ErrNoShards)
+	assert.Empty(t, result.Rows())
+}
@@ -0,0 +1,125 @@
+package nutsdb
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/XiBao/db/model"
+	"github.com/nutsdb/nutsdb"
+)
+
+var _ model.Sequence = (*Sequence)(nil)
+
+// Sequence is the nutsdb equivalent of badger.Sequence, it stores the end of its lease
+// at key as 8 bytes big endian, without expiry whatever the ttl of the table.
+type Sequence struct {
+	table     *Table
+	key       []byte
+	bandwidth uint64
+	mu        sync.Mutex
+	next      uint64
+	leased    uint64
+}
+
+// GetSequence returns the sequence stored at key, leasing bandwidth ids at a time.
+func (tb *Table) GetSequence(ctx context.Context, key []byte, bandwidth uint64) (*Sequence, error) {
+	if len(key) == 0 {
+		return nil, model.ErrEmptyKey
+	}
+	if bandwidth == 0 {
+		return nil, model.ErrZeroBandwidth
+	}
+	s := &Sequence{
+		table:     tb,
+		key:       key,
+		bandwidth: bandwidth,
+	}
+	if err := s.lease(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Sequence) Next(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextLocked()
+}
+
+func (s *Sequence) NextN(ctx context.Context, n int) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]uint64, 0, max(n, 0))
+	for range n {
+		id, err := s.nextLocked()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Close writes back the next id when the stored lease is still the one of s.
+func (s *Sequence) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next == s.leased {
+		return nil
+	}
+	err := s.table.db.Update(func(tx *nutsdb.Tx) error {
+		stored, err := s.stored(tx)
+		if err != nil || stored != s.leased {
+			return err
+		}
+		return tx.Put(s.table.name, s.key, binary.BigEndian.AppendUint64(nil, s.next), nutsdb.Persistent)
+	})
+	if err == nil {
+		s.leased = s.next
+	}
+	return err
+}
+
+func (s *Sequence) nextLocked() (uint64, error) {
+	if s.next >= s.leased {
+		if err := s.lease(); err != nil {
+			return 0, err
+		}
+	}
+	id := s.next
+	s.next++
+	return id, nil
+}
+
+// lease takes the next bandwidth ids, s only moves to them once the lease is committed.
+func (s *Sequence) lease() error {
+	var next, leased uint64
+	if err := s.table.db.Update(func(tx *nutsdb.Tx) error {
+		var err error
+		if next, err = s.stored(tx); err != nil {
+			return err
+		}
+		leased = next + s.bandwidth
+		return tx.Put(s.table.name, s.key, binary.BigEndian.AppendUint64(nil, leased), nutsdb.Persistent)
+	}); err != nil {
+		return err
+	}
+	s.next, s.leased = next, leased
+	return nil
+}
+
+// stored returns the end of the last lease, 0 for a new sequence.
+func (s *Sequence) stored(tx *nutsdb.Tx) (uint64, error) {
+	value, err := tx.Get(s.table.name, s.key)
+	if errors.Is(err, nutsdb.ErrNotFoundKey) || errors.Is(err, nutsdb.ErrKeyNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if len(value) != 8 {
+		return 0, errors.New("invalid sequence value")
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
@@ -0,0 +1,58 @@
+package nutsdb_test
+
+import (
+	"context"
+	"testing"
+
+	nuts "github.com/nutsdb/nutsdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/XiBao/db/model"
+	"github.com/XiBao/db/nutsdb"
+)
+
+func TestSequenceRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	open := func() (*nuts.DB, *nutsdb.Table) {
+		db, err := nuts.Open(nuts.DefaultOptions, nuts.WithDir(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		table, err := nutsdb.NewTable(db, "seq", nuts.Persistent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db, table
+	}
+
+	db, table := open()
+	_, err := table.GetSequence(ctx, []byte("ids"), 0)
+	assert.ErrorIs(t, err, model.ErrZeroBandwidth)
+	seq, err := table.GetSequence(ctx, []byte("ids"), 10)
+	assert.NoError(t, err)
+	ids, err := seq.NextN(ctx, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{0, 1, 2}, ids)
+	assert.NoError(t, seq.Close(ctx))
+	assert.NoError(t, db.Close())
+
+	// the closed sequence continues where it stopped
+	db, table = open()
+	seq, err = table.GetSequence(ctx, []byte("ids"), 10)
+	assert.NoError(t, err)
+	ids, err = seq.NextN(ctx, 12)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), ids[0])
+	assert.Equal(t, uint64(14), ids[11])
+	assert.NoError(t, db.Close())
+
+	// without Close the rest of the lease is skipped
+	db, table = open()
+	defer db.Close()
+	seq, err = table.GetSequence(ctx, []byte("ids"), 10)
+	assert.NoError(t, err)
+	id, err := seq.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(23), id)
+}
@@ -39,12 +39,28 @@ func (tb Table) TTL() uint32 {
 	return tb.ttl
 }
 
+// View runs fn in a read only transaction, fn accesses the table through Name.
+func (tb *Table) View(ctx context.Context, fn func(tx *nutsdb.Tx) error) error {
+	return tb.db.View(fn)
+}
+
+// Update runs fn in a read-write transaction committed when fn returns nil.
+func (tb *Table) Update(ctx context.Context, fn func(tx *nutsdb.Tx) error) error {
+	return tb.db.Update(fn)
+}
+
 func (tb *Table) Set(ctx context.Context, key []byte, val []byte) error {
 	return tb.db.Update(func(tx *nutsdb.Tx) error {
 		return tx.Put(tb.name, key, val, tb.ttl)
 	})
 }
 
+func (tb *Table) SetWithTTL(ctx context.Context, key []byte, val []byte, ttl uint32) error {
+	return tb.db.Update(func(tx *nutsdb.Tx) error {
+		return tx.Put(tb.name, key, val, ttl)
+	})
+}
+
 func (tb *Table) Persist(ctx context.Context, key []byte, val []byte) error {
 	return tb.db.Update(func(tx *nutsdb.Tx) error {
 		return tx.Put(tb.name, key, val, nutsdb.Persistent)